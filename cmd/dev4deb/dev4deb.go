@@ -2,7 +2,9 @@ package main
 
 import (
 	"bufio"
-	"errors"
+	"dev4os/bootstrap"
+	"dev4os/loginshell"
+	"dev4os/shellrc"
 	"fmt"
 	"github.com/briandowns/spinner"
 	"io/ioutil"
@@ -10,14 +12,16 @@ import (
 	"os"
 	"os/exec"
 	"os/user"
+	"strings"
 	"time"
 )
 
 var (
 	appVer      = "0.1"
 	lstDot      = " • "
-	shrcPath    = homeDir() + ".zshrc"
-	profilePath = homeDir() + ".zprofile"
+	userShell   = checkShell()
+	shrcPath    = shellRCPath()
+	profilePath = shellProfilePath()
 	superUser   = "sudo"
 	cmdPMS      = "apt"
 	pmsIns      = "install"
@@ -29,15 +33,11 @@ var (
 	cmdSys     = "systemctl"
 	cmdEnable  = "enable"
 	//cmdDisable = "disable"
-	cmdStart   = "start"
-	cmdGit     = "git"
-	gitClone   = "clone"
-	cmdASDF    = homeDir() + ".asdf/"
-	asdfPlugin = "plugin"
-	asdfAdd    = "add"
-	asdfShim   = "reshim"
-	chooseCmd  = "Select command: "
-	cmdOpt     string
+	cmdStart  = "start"
+	cmdGit    = "git"
+	gitClone  = "clone"
+	chooseCmd = "Select command: "
+	cmdOpt    string
 )
 
 func checkError(err error) bool {
@@ -74,12 +74,6 @@ func homeDir() string {
 	return homeDirPath + "/"
 }
 
-func workingDir() string {
-	workingDirPath, err := os.Getwd()
-	checkError(err)
-	return workingDirPath + "/"
-}
-
 func currentUser() string {
 	userName, err := user.Current()
 	checkError(err)
@@ -87,6 +81,7 @@ func currentUser() string {
 }
 
 func makeFile(filePath, fileContents string) {
+	checkError(bootstrap.Snapshot(filePath))
 	targetFile, err := os.OpenFile(filePath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, os.FileMode(0600))
 	checkError(err)
 	defer func() {
@@ -98,6 +93,7 @@ func makeFile(filePath, fileContents string) {
 }
 
 func appendFile(filePath, fileContents string) {
+	checkError(bootstrap.Snapshot(filePath))
 	targetFile, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, os.FileMode(0600))
 	checkError(err)
 	defer func() {
@@ -108,6 +104,14 @@ func appendFile(filePath, fileContents string) {
 	checkError(err)
 }
 
+// appendShell appends a snippet under a comment header, rendered for the
+// login shell. A snippet without a line for that shell is left out.
+func appendShell(filePath, header string, lines ...shellrc.Line) {
+	if shellContents := shellrc.Render(userShell, lines...); strings.TrimSpace(shellContents) != "" {
+		appendFile(filePath, "# "+header+"\n"+shellContents+"\n")
+	}
+}
+
 func rmFile(filePath string) {
 	if _, err := os.Stat(filePath); !os.IsNotExist(err) {
 		err := os.Remove(filePath)
@@ -115,14 +119,67 @@ func rmFile(filePath string) {
 	}
 }
 
-func newZProfile() {
-	fileContents := "# " + currentUser() + "’s profile\n\n" +
-		"# ZSH\n" +
-		"export SHELL=zsh\n"
+// checkShell is the login shell the environment is written for, zsh when
+// the user has none of the shells dev4os supports.
+func checkShell() string {
+	if checkedShell := loginshell.Detect(currentUser()); checkedShell != "" {
+		return checkedShell
+	}
+	return "zsh"
+}
+
+func shellRCPath() string {
+	if userShell == "fish" {
+		return homeDir() + ".config/fish/config.fish"
+	}
+	return homeDir() + "." + userShell + "rc"
+}
+
+func shellProfilePath() string {
+	if userShell == "bash" {
+		return homeDir() + ".bash_profile"
+	} else if userShell == "fish" {
+		return shellRCPath()
+	}
+	return homeDir() + ".zprofile"
+}
+
+// sourceHint is the command that loads the new rc files in a running shell.
+func sourceHint() string {
+	if userShell == "fish" {
+		return "source ~/.config/fish/config.fish"
+	}
+	return "source " + strings.Replace(profilePath, homeDir(), "~/", 1) + " && source " + strings.Replace(shrcPath, homeDir(), "~/", 1)
+}
+
+func newProfile() {
+	if userShell == "fish" {
+		return
+	}
+	fileContents := "# " + currentUser() + "’s profile\n\n" + shellEnv()
+	if userShell == "bash" {
+		fileContents += shellrc.Render(userShell, shellrc.Source(homeDir()+".bashrc"))
+	}
 	makeFile(profilePath, fileContents)
 }
 
-func newZshRC() {
+// shellEnv names the login shell in $SHELL, in the profile or in config.fish
+// for fish.
+func shellEnv() string {
+	return "# " + strings.ToUpper(userShell) + "\n" + shellrc.Render(userShell, shellrc.Export("SHELL", userShell))
+}
+
+func newShellRC() {
+	if userShell == "bash" {
+		makeFile(shrcPath, "# "+currentUser()+"’s bashrc\n\n")
+		return
+	} else if userShell == "fish" {
+		if err := os.MkdirAll(homeDir()+".config/fish", 0755); err != nil {
+			checkError(err)
+		}
+		makeFile(shrcPath, "# "+currentUser()+"’s fish config\n\n"+shellEnv())
+		return
+	}
 	fileContents := "#   _________  _   _ ____   ____    __  __    _    ___ _   _\n" +
 		"#  |__  / ___|| | | |  _ \\ / ___|  |  \\/  |  / \\  |_ _| \\ | |\n" +
 		"#    / /\\___ \\| |_| | |_) | |      | |\\/| | / _ \\  | ||  \\| |\n" +
@@ -131,36 +188,6 @@ func newZshRC() {
 	makeFile(shrcPath, fileContents)
 }
 
-func confA4s() {
-	dlA4sPath := workingDir() + ".dev4mac-alias4sh.sh"
-	resp, err := http.Get("https://raw.githubusercontent.com/leelsey/Alias4sh/main/install.sh")
-	if err != nil {
-		fmt.Println(lstDot + "Alias4sh‘s URL is maybe changed, please check https://github.com/leelsey/Alias4sh\n")
-		os.Exit(0)
-	}
-	defer func() {
-		err := resp.Body.Close()
-		checkError(err)
-	}()
-	rawFile, _ := ioutil.ReadAll(resp.Body)
-
-	a4sInstaller, err := os.OpenFile(dlA4sPath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, os.FileMode(0755))
-	checkError(err)
-	defer func() {
-		err := a4sInstaller.Close()
-		checkError(err)
-	}()
-	_, err = a4sInstaller.Write(rawFile)
-	checkError(err)
-
-	installA4s := exec.Command("/bin/sh", dlA4sPath)
-	if err := installA4s.Run(); err != nil {
-		rmFile(dlA4sPath)
-		checkError(err)
-	}
-	rmFile(dlA4sPath)
-}
-
 func confG4s() {
 	fmt.Println("\nGit global configuration")
 
@@ -225,26 +252,7 @@ func confG4s() {
 }
 
 func confZshTheme() {
-	dlP10kPath := homeDir() + ".p10k.zsh"
-	resp, err := http.Get("https://raw.githubusercontent.com/leelsey/Dev4os/main/cmd/dev4os/dev4p10k")
-	if err != nil {
-		fmt.Println(lstDot + "Dev4os‘s p10k file URL is maybe changed, please check https://github.com/leelsey/Dev4os\n")
-		os.Exit(0)
-	}
-	defer func() {
-		err := resp.Body.Close()
-		checkError(err)
-	}()
-	rawFile, _ := ioutil.ReadAll(resp.Body)
-
-	p10kConf, err := os.OpenFile(dlP10kPath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, os.FileMode(0644))
-	checkError(err)
-	defer func() {
-		err := p10kConf.Close()
-		checkError(err)
-	}()
-	_, err = p10kConf.Write(rawFile)
-	checkError(err)
+	checkError(bootstrap.Run("theme", "-backend", "p10k"))
 }
 
 func updateapt() {
@@ -330,16 +338,13 @@ func linuxEnv() {
 	ldBar.FinalMSG = " - Completed environment!\n"
 	ldBar.Start()
 
-	confA4s()
-	newZProfile()
-	newZshRC()
+	newProfile()
+	newShellRC()
 
-	profileAppend := "# Alias4sh\n" +
-		"source ~/.config/alias4sh/aliasrc\n" +
-		"# HOMEapt\n" +
-		"eval \"$(" + cmdPMS + " shellenv)\"\n"
-	appendFile(profilePath, profileAppend)
+	appendShell(profilePath, "HOMEapt", shellrc.Raw("eval \"$("+cmdPMS+" shellenv)\"", ""))
 	ldBar.Stop()
+
+	checkError(bootstrap.Run("aliases"))
 }
 
 func linuxGit() {
@@ -361,36 +366,36 @@ func linuxGit() {
 
 func linuxTerminal() {
 	ldBar := spinner.New(spinner.CharSets[16], 50*time.Millisecond)
-	ldBar.Suffix = " Installing zsh with useful tools..."
+	ldBar.Suffix = " Installing " + userShell + " with useful tools..."
 	ldBar.FinalMSG = " - Installed useful tools for terminal!\n"
 	ldBar.Start()
 
-	aptZsh := exec.Command(superUser, cmdPMS, pmsIns, pmsYes, "zsh")
+	aptShell := exec.Command(superUser, cmdPMS, pmsIns, pmsYes, userShell)
 	aptTree := exec.Command(superUser, cmdPMS, pmsIns, pmsYes, "tree")
-	aptZshSyntax := exec.Command(cmdGit, gitClone, "https://github.com/zsh-users/zsh-syntax-highlighting.git", "~/.zsh/zsh-syntax-highlighting")
-	aptZshAuto := exec.Command(cmdGit, gitClone, "https://github.com/zsh-users/zsh-autosuggestions.git", "~/.zsh/zsh-autosuggestions")
-	aptZshComp := exec.Command(cmdGit, gitClone, "https://github.com/zsh-users/zsh-completions.git", "~/.zsh/zsh-completions")
-	aptZshTheme := exec.Command(cmdGit, gitClone, "https://github.com/romkatv/powerlevel10k.git", "~/.zsh/powerlevel10k")
-	if err := aptZsh.Run(); err != nil {
+	if err := aptShell.Run(); err != nil {
 		checkError(err)
 	}
 	if err := aptTree.Run(); err != nil {
 		checkError(err)
 	}
-	if err := aptZshSyntax.Run(); err != nil {
-		checkError(err)
-	}
-	if err := aptZshAuto.Run(); err != nil {
-		checkError(err)
+	ldBar.Stop()
+
+	if userShell == "zsh" {
+		checkError(bootstrap.Run("zsh"))
 	}
-	if err := aptZshComp.Run(); err != nil {
-		checkError(err)
+}
+
+// linuxLoginShell makes the shell the environment was written for the login
+// shell, the same way "dev4os shell use" does.
+func linuxLoginShell() {
+	if strings.HasSuffix(loginshell.Passwd(currentUser()), "/"+userShell) == true {
+		return
 	}
-	if err := aptZshTheme.Run(); err != nil {
-		checkError(err)
+	if shellPath, err := loginshell.Change(userShell, currentUser(), superUser); err != nil {
+		fmt.Println(lstDot + "Failed to change login shell to " + userShell + " (" + err.Error() + "), run \"chsh -s $(command -v " + userShell + ")\" yourself.")
+	} else {
+		fmt.Println(lstDot + "Login shell is " + shellPath + ".")
 	}
-
-	ldBar.Stop()
 }
 
 func linuxDependency() {
@@ -695,8 +700,8 @@ func linuxDevToolCLI() {
 
 func linuxASDF() {
 	ldBar := spinner.New(spinner.CharSets[16], 50*time.Millisecond)
-	ldBar.Suffix = " Installing ASDF-VM with plugin..."
-	ldBar.FinalMSG = " - Installed ASDF-VM, and add basic languages!\n"
+	ldBar.Suffix = " Installing ASDF-VM..."
+	ldBar.FinalMSG = " - Installed ASDF-VM!\n"
 	ldBar.Start()
 
 	aptASDF := exec.Command(cmdGit, gitClone, "https://github.com/asdf-vm/asdf.git", homeDir()+".asdf", "--branch", "v0.10.2")
@@ -704,107 +709,13 @@ func linuxASDF() {
 		checkError(err)
 	}
 
-	shrcAppend := "# DIRENV\n" +
-		"source" + homeDir() + "/.asdf/asdf.sh\n" +
-		"source " + homeDir() + "/.asdf/completions/asdf.bash\n\n"
-	appendFile(shrcPath, shrcAppend)
+	appendShell(shrcPath, "ASDF VM",
+		shellrc.Raw("source "+homeDir()+".asdf/asdf.sh", "source "+homeDir()+".asdf/asdf.fish"),
+		shellrc.Raw("source "+homeDir()+".asdf/completions/asdf.bash", ""))
 
-	pluginPath := homeDir() + ".asdf/plugins/"
-	if _, err := os.Stat(pluginPath + "perl"); errors.Is(err, os.ErrNotExist) {
-		addASDFPerl := exec.Command(cmdASDF, asdfPlugin, asdfAdd, "perl")
-		if err := addASDFPerl.Run(); err != nil {
-			checkError(err)
-		}
-	}
-	if _, err := os.Stat(pluginPath + "ruby"); errors.Is(err, os.ErrNotExist) {
-		addASDFRuby := exec.Command(cmdASDF, asdfPlugin, asdfAdd, "ruby")
-		if err := addASDFRuby.Run(); err != nil {
-			checkError(err)
-		}
-	}
-	if _, err := os.Stat(pluginPath + "python"); errors.Is(err, os.ErrNotExist) {
-		addASDFPython := exec.Command(cmdASDF, asdfPlugin, asdfAdd, "python")
-		if err := addASDFPython.Run(); err != nil {
-			checkError(err)
-		}
-	}
-	if _, err := os.Stat(pluginPath + "lua"); errors.Is(err, os.ErrNotExist) {
-		addASDFLua := exec.Command(cmdASDF, asdfPlugin, asdfAdd, "lua")
-		if err := addASDFLua.Run(); err != nil {
-			checkError(err)
-		}
-	}
-	if _, err := os.Stat(pluginPath + "golang"); errors.Is(err, os.ErrNotExist) {
-		addASDFGo := exec.Command(cmdASDF, asdfPlugin, asdfAdd, "golang")
-		if err := addASDFGo.Run(); err != nil {
-			checkError(err)
-		}
-	}
-	if _, err := os.Stat(pluginPath + "rust"); errors.Is(err, os.ErrNotExist) {
-		addASDFRust := exec.Command(cmdASDF, asdfPlugin, asdfAdd, "rust")
-		if err := addASDFRust.Run(); err != nil {
-			checkError(err)
-		}
-	}
-	if _, err := os.Stat(pluginPath + "nodejs"); errors.Is(err, os.ErrNotExist) {
-		addASDFNode := exec.Command(cmdASDF, asdfPlugin, asdfAdd, "nodejs")
-		if err := addASDFNode.Run(); err != nil {
-			checkError(err)
-		}
-	}
-	if _, err := os.Stat(pluginPath + "php"); errors.Is(err, os.ErrNotExist) {
-		addASDFPHP := exec.Command(cmdASDF, asdfPlugin, asdfAdd, "php")
-		if err := addASDFPHP.Run(); err != nil {
-			checkError(err)
-		}
-	}
-	if _, err := os.Stat(pluginPath + "java"); errors.Is(err, os.ErrNotExist) {
-		addASDFJava := exec.Command(cmdASDF, asdfPlugin, asdfAdd, "java")
-		if err := addASDFJava.Run(); err != nil {
-			checkError(err)
-		}
-	}
-	if _, err := os.Stat(pluginPath + "groovy"); errors.Is(err, os.ErrNotExist) {
-		addASDFGroovy := exec.Command(cmdASDF, asdfPlugin, asdfAdd, "groovy")
-		if err := addASDFGroovy.Run(); err != nil {
-			checkError(err)
-		}
-	}
-	if _, err := os.Stat(pluginPath + "kotlin"); errors.Is(err, os.ErrNotExist) {
-		addASDFKotlin := exec.Command(cmdASDF, asdfPlugin, asdfAdd, "kotlin")
-		if err := addASDFKotlin.Run(); err != nil {
-			checkError(err)
-		}
-	}
-	if _, err := os.Stat(pluginPath + "scala"); errors.Is(err, os.ErrNotExist) {
-		addASDFScala := exec.Command(cmdASDF, asdfPlugin, asdfAdd, "scala")
-		if err := addASDFScala.Run(); err != nil {
-			checkError(err)
-		}
-	}
-	if _, err := os.Stat(pluginPath + "clojure"); errors.Is(err, os.ErrNotExist) {
-		addASDFClojure := exec.Command(cmdASDF, asdfPlugin, asdfAdd, "clojure")
-		if err := addASDFClojure.Run(); err != nil {
-			checkError(err)
-		}
-	}
-	if _, err := os.Stat(pluginPath + "erlang"); errors.Is(err, os.ErrNotExist) {
-		addASDFErlang := exec.Command(cmdASDF, asdfPlugin, asdfAdd, "erlang")
-		if err := addASDFErlang.Run(); err != nil {
-			checkError(err)
-		}
-	}
-	if _, err := os.Stat(pluginPath + "elixir"); errors.Is(err, os.ErrNotExist) {
-		addASDFElixir := exec.Command(cmdASDF, asdfPlugin, asdfAdd, "elixir")
-		if err := addASDFElixir.Run(); err != nil {
-			checkError(err)
-		}
-	}
-	asdfReshim := exec.Command(cmdASDF, asdfShim)
-	if err := asdfReshim.Run(); err != nil {
-		checkError(err)
-	}
 	ldBar.Stop()
+
+	checkError(bootstrap.Run("runtimes"))
 }
 
 func linuxServer() {
@@ -865,7 +776,7 @@ func linuxLanguage() {
 	aptRust := exec.Command(superUser, cmdPMS, pmsIns, pmsYes, "rust")
 	aptNode := exec.Command(superUser, cmdPMS, pmsIns, pmsYes, "nodejs")
 	aptPHP := exec.Command(superUser, cmdPMS, pmsIns, pmsYes, "php")
-	aptJDK := exec.Command(superUser, cmdPMS, pmsIns, pmsYes, "java")
+	aptJDK := exec.Command(superUser, cmdPMS, pmsIns, pmsYes, "default-jdk")
 
 	if err := aptPerl.Run(); err != nil {
 		checkError(err)
@@ -953,12 +864,21 @@ func linuxEnd() {
 
 func main() {
 	fmt.Println("\nDev4mac v" + appVer + "\n")
+	if _, err := bootstrap.Path(); err != nil {
+		fmt.Println(lstDot + err.Error() + "\n")
+		os.Exit(1)
+	}
+	// The dev4os steps write their blocks for the shell this run sets up,
+	// also when it falls back to zsh.
+	os.Setenv("DEV4OS_SHELL", userShell)
 	if checkNetStatus() == true {
+		checkError(bootstrap.StartBackup("dev4deb"))
 		linuxBegin()
 		linuxBasic()
 		linuxEnv()
 		linuxGit()
 		linuxTerminal()
+		linuxLoginShell()
 		linuxDependency()
 		linuxDevToolCLI()
 		linuxASDF()
@@ -992,7 +912,7 @@ func main() {
 		}
 		fmt.Println("\n----------Finished!----------\n" +
 			"Please RESTART your terminal!\n" +
-			lstDot + "Enter this on terminal: source ~/.zprofile && source ~/.zshrc\n" +
+			lstDot + "Enter this on terminal: " + sourceHint() + "\n" +
 			lstDot + "Or restart the Terminal.app by yourself.\n")
 	} else {
 		fmt.Println(lstDot + "Please check your internet connection and try again.\n")
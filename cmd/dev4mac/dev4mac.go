@@ -2,6 +2,9 @@ package main
 
 import (
 	"bufio"
+	"dev4os/bootstrap"
+	"dev4os/loginshell"
+	"dev4os/shellrc"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,6 +16,7 @@ import (
 	"os"
 	"os/exec"
 	"os/user"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"time"
@@ -21,8 +25,9 @@ import (
 var (
 	appVer     = "0.5"
 	lstDot     = " • "
-	shrcPath   = homeDir() + ".zshrc"
-	prfPath    = homeDir() + ".zprofile"
+	userShell  = checkShell()
+	shrcPath   = shellRCPath()
+	prfPath    = shellProfilePath()
 	arm64Path  = "/opt/homebrew/"
 	amd64Path  = "/usr/local/"
 	brewPrefix = checkBrewPrefix()
@@ -37,9 +42,6 @@ var (
 	//optRm      = "remove"
 	optAlt    = "--cask"
 	optRepo   = "tap"
-	fontPath  = homeDir() + "Library/Fonts/"
-	p10kPath  = homeDir() + ".config/p10k/"
-	p10kCache = homeDir() + ".cache/p10k-" + userName()
 	tryLoop   = 0
 	clrReset  = "\033[0m"
 	clrRed    = "\033[31m"
@@ -53,6 +55,28 @@ var (
 	macLdBar  = spinner.New(spinner.CharSets[16], 50*time.Millisecond)
 )
 
+// compilerFlags collects the directories of keg-only packages while they are
+// installed, so macEnd writes LDFLAGS, CPPFLAGS and PKG_CONFIG_PATH once.
+type compilerFlags struct {
+	libDirs       []string
+	includeDirs   []string
+	pkgConfigDirs []string
+}
+
+var buildFlags compilerFlags
+
+// brewKegPaths are the bin directories of the keg-only packages that go on
+// PATH, the same list "dev4os path" keeps. androidSDKPaths are the tool
+// directories of the Android SDK.
+var (
+	brewKegPaths = []string{
+		"ncurses/bin", "openssl@3/bin", "openssl@1.1/bin", "krb5/bin", "krb5/sbin", "gnu-getopt/bin",
+		"tcl-tk/bin", "bzip2/bin", "bison/bin", "icu4c/bin", "icu4c/sbin", "libiconv/bin",
+		"libxml2/bin", "libxslt/bin", "curl/bin", "sqlite/bin", "ccache/libexec", "ruby/bin",
+	}
+	androidSDKPaths = []string{"emulator", "tools", "tools/bin", "platform-tools"}
+)
+
 func messageError(handling, msg, code string) {
 	errOccurred := clrRed + "\nError occurred " + clrReset + "at "
 	errMsgFormat := "\n" + clrRed + "Error >> " + clrReset + msg + " (" + code + ")\n"
@@ -102,6 +126,41 @@ func checkExists(path string) bool {
 	}
 }
 
+// checkShell names the shell to set up, the login shell or zsh when the
+// login shell is none of bash, zsh and fish.
+func checkShell() string {
+	if detectedShell := loginshell.Detect(userName()); detectedShell != "" {
+		return detectedShell
+	}
+	return "zsh"
+}
+
+func shellRCPath() string {
+	if userShell == "fish" {
+		return homeDir() + ".config/fish/config.fish"
+	}
+	return homeDir() + "." + userShell + "rc"
+}
+
+// shellProfilePath is the file a login shell reads, config.fish for fish
+// which has no separate one.
+func shellProfilePath() string {
+	if userShell == "zsh" {
+		return homeDir() + ".zprofile"
+	} else if userShell == "bash" {
+		return homeDir() + ".bash_profile"
+	}
+	return shellRCPath()
+}
+
+// sourceHint is the command that loads the new rc files in a running shell.
+func sourceHint() string {
+	if prfPath == shrcPath {
+		return "source " + strings.Replace(shrcPath, homeDir(), "~/", 1)
+	}
+	return "source " + strings.Replace(prfPath, homeDir(), "~/", 1) + " && source " + strings.Replace(shrcPath, homeDir(), "~/", 1)
+}
+
 func checkArchitecture() bool {
 	switch runtime.GOARCH {
 	case "arm64":
@@ -262,12 +321,6 @@ func homeDir() string {
 	return homeDirPath + "/"
 }
 
-func workingDir() string {
-	workingDirPath, err := os.Getwd()
-	checkError(err, "Failed to get working directory")
-	return workingDirPath + "/"
-}
-
 func userName() string {
 	workingUser, err := user.Current()
 	checkError(err, "Failed to get current user")
@@ -320,6 +373,7 @@ func makeDirectory(dirPath string) {
 //}
 
 func makeFile(filePath, fileContents string, fileMode int) {
+	checkError(bootstrap.Snapshot(filePath), "Failed to back up \""+filePath+"\"")
 	targetFile, err := os.OpenFile(filePath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, os.FileMode(fileMode))
 	checkError(err, "Failed to get file information to make new file from \""+filePath+"\"")
 
@@ -332,25 +386,6 @@ func makeFile(filePath, fileContents string, fileMode int) {
 	checkError(err, "Failed to fill in information to \""+filePath+"\"")
 }
 
-func copyFile(srcPath, dstPath string) {
-	srcFile, err := os.Open(srcPath)
-	checkError(err, "Failed to get file information to copy from \""+srcPath+"\"")
-	dstFile, err := os.Create(dstPath)
-	checkError(err, "Failed to get file information to copy to \""+dstPath+"\"")
-
-	defer func() {
-		errSrcFileClose := srcFile.Close()
-		checkError(errSrcFileClose, "Failed to finish copy file from \""+srcPath+"\"")
-		errDstFileClose := dstFile.Close()
-		checkError(errDstFileClose, "Failed to finish copy file to \""+dstPath+"\"")
-	}()
-
-	_, errCopy := io.Copy(dstFile, srcFile)
-	checkError(errCopy, "Failed to copy file from \""+srcPath+"\" to \""+dstPath+"\"")
-	errSync := dstFile.Sync()
-	checkError(errSync, "Failed to sync file from \""+srcPath+"\" to \""+dstPath+"\"")
-}
-
 func removeFile(filePath string) {
 	if checkExists(filePath) == true {
 		err := os.Remove(filePath)
@@ -399,6 +434,7 @@ func linkFile(srcPath, dstPath, linkType, permission, adminCode string) {
 }
 
 func appendContents(filePath, fileContents string, fileMode int) {
+	checkError(bootstrap.Snapshot(filePath), "Failed to back up \""+filePath+"\"")
 	targetFile, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, os.FileMode(fileMode))
 	checkError(err, "Failed to get file information to append contents from \""+filePath+"\"")
 
@@ -411,6 +447,79 @@ func appendContents(filePath, fileContents string, fileMode int) {
 	checkError(err, "Failed to append contents to \""+filePath+"\"")
 }
 
+// appendShell appends a snippet under a comment header, rendered for the
+// shell being set up. A snippet without a line for that shell is left out.
+func appendShell(filePath, header string, lines ...shellrc.Line) {
+	if shellContents := shellrc.Render(userShell, lines...); strings.TrimSpace(shellContents) != "" {
+		appendContents(filePath, "# "+header+"\n"+shellContents+"\n", 0644)
+	}
+}
+
+func appendUnique(items []string, item string) []string {
+	for _, oldItem := range items {
+		if oldItem == item {
+			return items
+		}
+	}
+	return append(items, item)
+}
+
+// addBuildFlags adds the lib, include and pkgconfig directories each package
+// has. The first package added comes first, so it wins when two packages
+// ship the same library.
+func addBuildFlags(pkgs ...string) {
+	for _, pkg := range pkgs {
+		optPath := brewPrefix + "opt/" + pkg + "/"
+		if checkExists(optPath+"lib") == true {
+			buildFlags.libDirs = appendUnique(buildFlags.libDirs, optPath+"lib")
+		}
+		if checkExists(optPath+"include") == true {
+			buildFlags.includeDirs = appendUnique(buildFlags.includeDirs, optPath+"include")
+		}
+		if checkExists(optPath+"lib/pkgconfig") == true {
+			buildFlags.pkgConfigDirs = appendUnique(buildFlags.pkgConfigDirs, optPath+"lib/pkgconfig")
+		}
+	}
+}
+
+func composeBuildFlags() string {
+	var flagLines []shellrc.Line
+	if len(buildFlags.libDirs) > 0 {
+		flagLines = append(flagLines, shellrc.Export("LDFLAGS", "-L"+strings.Join(buildFlags.libDirs, " -L")))
+	}
+	if len(buildFlags.includeDirs) > 0 {
+		flagLines = append(flagLines, shellrc.Export("CPPFLAGS", "-I"+strings.Join(buildFlags.includeDirs, " -I")))
+	}
+	if len(buildFlags.pkgConfigDirs) > 0 {
+		flagLines = append(flagLines, shellrc.Export("PKG_CONFIG_PATH", strings.Join(buildFlags.pkgConfigDirs, ":")))
+	}
+	if len(flagLines) == 0 {
+		return ""
+	}
+	return "# >>> dev4os build-flags >>>\n" + shellrc.Render(userShell, flagLines...) + "# <<< dev4os build-flags <<<\n"
+}
+
+// composePath writes the PATH entries of the keg-only packages and the
+// Android SDK as the path block of dev4os, which "dev4os path" regenerates
+// with the same entries instead of stacking another export per package.
+func composePath() string {
+	var pathDirs []string
+	for _, kegPath := range brewKegPaths {
+		if checkExists(brewPrefix+"opt/"+kegPath) == true {
+			pathDirs = append(pathDirs, brewPrefix+"opt/"+kegPath)
+		}
+	}
+	for _, sdkPath := range androidSDKPaths {
+		if checkExists(homeDir()+"Library/Android/sdk/"+sdkPath) == true {
+			pathDirs = append(pathDirs, "$HOME/Library/Android/sdk/"+sdkPath)
+		}
+	}
+	if len(pathDirs) == 0 {
+		return ""
+	}
+	return "# >>> dev4os path >>>\n" + shellrc.Render(userShell, shellrc.Path(pathDirs...)) + "# <<< dev4os path <<<\n"
+}
+
 func downloadFile(filePath, urlPath string, fileMode int) {
 	makeFile(filePath, netHTTP(urlPath), fileMode)
 }
@@ -422,13 +531,13 @@ func startApplication(appName string) {
 }
 
 func changeAppIcon(appName, icnName, adminCode string) {
-	srcIcn := workingDir() + ".dev4mac-app-icn.icns"
+	srcIcn := filepath.Join(os.TempDir(), "dev4os-mac-app-icn.icns")
 	downloadFile(srcIcn, "https://raw.githubusercontent.com/leelsey/ConfStore/main/icns/"+icnName, 0755)
 
 	appSrc := strings.Replace(appName, " ", "\\ ", -1)
 	appPath := "/Applications/" + appSrc + ".app"
-	chicnPath := workingDir() + ".dev4mac-chicn.sh"
-	cvtIcn := workingDir() + ".dev4mac-app-icn.rsrc"
+	chicnPath := filepath.Join(os.TempDir(), "dev4os-mac-chicn.sh")
+	cvtIcn := filepath.Join(os.TempDir(), "dev4os-mac-app-icn.rsrc")
 	chIcnSrc := "sudo rm -rf \"" + appPath + "\"$'/Icon\\r'\n" +
 		"sips -i " + srcIcn + " > /dev/null\n" +
 		"DeRez -only icns " + srcIcn + " > " + cvtIcn + "\n" +
@@ -534,54 +643,12 @@ func brewInstallCaskSudo(pkg, appName, appPath, adminCode string) {
 	}
 }
 
-func asdfInstall(plugin, version string) {
-	if checkExists(homeDir()+".asdf/plugins/"+plugin) != true {
-		asdfPlugin := exec.Command(cmdASDF, "plugin", "add", plugin)
-		err := asdfPlugin.Run()
-		checkCmdError(err, "ASDF-VM failed to add", plugin)
-	}
-
-	asdfReshim()
-	asdfIns := exec.Command(cmdASDF, optIns, plugin, version)
-	asdfIns.Env = os.Environ()
-	errIns := asdfIns.Run()
-	checkCmdError(errIns, "ASDF-VM", plugin)
-
-	asdfGlobal := exec.Command(cmdASDF, "global", plugin, version)
-	asdfGlobal.Env = os.Environ()
-	errConf := asdfGlobal.Run()
-	checkCmdError(errConf, "ASDF-VM failed to install", plugin)
-}
-
-func asdfReshim() {
-	reshim := exec.Command(cmdASDF, "reshim")
-	err := reshim.Run()
-	checkCmdError(err, "ASDF failed to", "reshim")
-}
-
 func addJavaHome(srcVer, dstVer, adminCode string) {
 	if checkExists(brewPrefix+"Cellar/openjdk"+srcVer) == true {
 		linkFile(brewPrefix+"opt/openjdk"+srcVer+" /libexec/openjdk.jdk", "/Library/Java/JavaVirtualMachines/openjdk"+dstVer+".jdk", "symbolic", "root", adminCode)
 	}
 }
 
-func confA4s() {
-	a4sPath := homeDir() + ".config/alias4sh"
-	makeDirectory(a4sPath)
-	makeFile(a4sPath+"/alias4.sh", "# ALIAS4SH", 0644)
-
-	dlA4sPath := workingDir() + ".dev4mac-alias4sh.sh"
-	downloadFile(dlA4sPath, "https://raw.githubusercontent.com/leelsey/Alias4sh/main/install.sh", 0644)
-
-	installA4s := exec.Command("sh", dlA4sPath)
-	if err := installA4s.Run(); err != nil {
-		removeFile(dlA4sPath)
-		checkError(err, "Failed to install Alias4sh")
-	}
-
-	removeFile(dlA4sPath)
-}
-
 func confG4s() {
 	fmt.Println(clrCyan + "Git global configuration" + clrReset)
 
@@ -629,7 +696,7 @@ func confG4s() {
 }
 
 func installBrew(adminCode string) {
-	insBrewPath := workingDir() + ".dev4mac-brew.sh"
+	insBrewPath := filepath.Join(os.TempDir(), "dev4os-mac-brew.sh")
 	downloadFile(insBrewPath, "https://raw.githubusercontent.com/Homebrew/install/HEAD/install.sh", 0755)
 
 	needPermission(adminCode)
@@ -681,37 +748,39 @@ func macEnv() {
 	macLdBar.Suffix = " Setting basic environment... "
 	macLdBar.Start()
 
-	if checkExists(prfPath) == true {
-		copyFile(prfPath, homeDir()+".zprofile.bck")
-	}
-	if checkExists(shrcPath) == true {
-		copyFile(shrcPath, homeDir()+".zshrc.bck")
-	}
-
-	profileContents := "#    ___________  _____   ____  ______ _____ _      ______ \n" +
-		"#   |___  /  __ \\|  __ \\ / __ \\|  ____|_   _| |    |  ____|\n" +
-		"#      / /| |__) | |__) | |  | | |__    | | | |    | |__   \n" +
-		"#     / / |  ___/|  _  /| |  | |  __|   | | | |    |  __|  \n" +
-		"#    / /__| |    | | \\ \\| |__| | |     _| |_| |____| |____ \n" +
-		"#   /_____|_|    |_|  \\_\\\\____/|_|    |_____|______|______|\n#\n" +
-		"#  " + userName() + "’s zsh profile\n\n" +
-		"# HOMEBREW\n" +
-		"eval \"$(" + cmdPMS + " shellenv)\"\n\n"
-	makeFile(prfPath, profileContents, 0644)
-
-	shrcContents := "#   ______ _____ _    _ _____   _____\n" +
-		"#  |___  // ____| |  | |  __ \\ / ____|\n" +
-		"#     / /| (___ | |__| | |__) | |\n" +
-		"#    / /  \\___ \\|  __  |  _  /| |\n" +
-		"#   / /__ ____) | |  | | | \\ \\| |____\n" +
-		"#  /_____|_____/|_|  |_|_|  \\_\\\\_____|\n#\n" +
-		"#  " + userName() + "’s zsh run commands\n\n"
-	makeFile(shrcPath, shrcContents, 0644)
+	brewEnv := "# HOMEBREW\n" + shellrc.Render(userShell, shellrc.Eval(cmdPMS+" shellenv "+userShell)) + "\n"
+	profileContents := "#  " + userName() + "’s " + userShell + " profile\n\n" + brewEnv
+	shrcContents := "#  " + userName() + "’s " + userShell + " run commands\n\n"
+	if userShell == "zsh" {
+		profileContents = "#    ___________  _____   ____  ______ _____ _      ______ \n" +
+			"#   |___  /  __ \\|  __ \\ / __ \\|  ____|_   _| |    |  ____|\n" +
+			"#      / /| |__) | |__) | |  | | |__    | | | |    | |__   \n" +
+			"#     / / |  ___/|  _  /| |  | |  __|   | | | |    |  __|  \n" +
+			"#    / /__| |    | | \\ \\| |__| | |     _| |_| |____| |____ \n" +
+			"#   /_____|_|    |_|  \\_\\\\____/|_|    |_____|______|______|\n#\n" + profileContents
+		shrcContents = "#   ______ _____ _    _ _____   _____\n" +
+			"#  |___  // ____| |  | |  __ \\ / ____|\n" +
+			"#     / /| (___ | |__| | |__) | |\n" +
+			"#    / /  \\___ \\|  __  |  _  /| |\n" +
+			"#   / /__ ____) | |  | | | \\ \\| |____\n" +
+			"#  /_____|_____/|_|  |_|_|  \\_\\\\_____|\n#\n" + shrcContents
+	} else if userShell == "bash" {
+		// A login bash reads only .bash_profile, which has to load .bashrc.
+		profileContents += shellrc.Render(userShell, shellrc.Source(homeDir()+".bashrc")) + "\n"
+	}
+
+	if userShell == "fish" {
+		makeDirectory(homeDir() + ".config/fish")
+		makeFile(shrcPath, "#  "+userName()+"’s fish config\n\n"+brewEnv, 0644)
+	} else {
+		makeFile(prfPath, profileContents, 0644)
+		makeFile(shrcPath, shrcContents, 0644)
+	}
 
 	makeDirectory(homeDir() + ".config")
 	makeDirectory(homeDir() + ".cache")
 
-	macLdBar.FinalMSG = lstDot + clrGreen + "Succeed " + clrReset + "setup zsh environment!\n"
+	macLdBar.FinalMSG = lstDot + clrGreen + "Succeed " + clrReset + "setup " + userShell + " environment!\n"
 	macLdBar.Stop()
 }
 
@@ -755,22 +824,7 @@ func macDependency(runOpt string) {
 	brewInstall("pcre")
 	brewInstall("pcre2")
 
-	shrcAppend := "# NCURSES\n" +
-		"export PATH=\"" + brewPrefix + "opt/ncurses/bin:$PATH\"\n" +
-		"export LDFLAGS=\"" + brewPrefix + "opt/ncurses/lib\"\n" +
-		"export CPPFLAGS=\"" + brewPrefix + "opt/ncurses/include\"\n" +
-		"export PKG_CONFIG_PATH=\"" + brewPrefix + "opt/ncurses/lib/pkgconfig\"\n\n" +
-		"# OPENSSL-3\n" +
-		"export PATH=\"" + brewPrefix + "opt/openssl@3/bin:$PATH\"\n" +
-		"export LDFLAGS=\"-L" + brewPrefix + "opt/openssl@3/lib\"\n" +
-		"export CPPFLAGS=\"-I" + brewPrefix + "opt/openssl@3/include\"\n" +
-		"export PKG_CONFIG_PATH=\"" + brewPrefix + "opt/openssl@3/lib/pkgconfig\"\n\n" +
-		"# OPENSSL-1.1\n" +
-		"export PATH=\"" + brewPrefix + "opt/openssl@1.1/bin:$PATH\"\n" +
-		"export LDFLAGS=\"-L" + brewPrefix + "opt/openssl@1.1/lib\"\n" +
-		"export CPPFLAGS=\"-I" + brewPrefix + "opt/openssl@1.1/include\"\n" +
-		"export PKG_CONFIG_PATH=\"" + brewPrefix + "opt/openssl@1.1/lib/pkgconfig\"\n\n"
-	appendContents(shrcPath, shrcAppend, 0644)
+	addBuildFlags("ncurses", "openssl@3", "openssl@1.1")
 
 	if runOpt != "2" && runOpt != "3" {
 		brewInstall("ccache")
@@ -858,60 +912,8 @@ func macDependency(runOpt string) {
 		brewInstall("glib")
 		brewInstall("zlib")
 
-		shrcAppend := "# KRB5\n" +
-			"export PATH=\"" + brewPrefix + "opt/krb5/bin:$PATH\"\n" +
-			"export PATH=\"" + brewPrefix + "opt/krb5/sbin:$PATH\"\n" +
-			"export LDFLAGS=\"" + brewPrefix + "opt/krb5/lib\"\n" +
-			"export CPPFLAGS=\"" + brewPrefix + "opt/krb5/include\"\n" +
-			"export PKG_CONFIG_PATH=\"" + brewPrefix + "opt/krb5/lib/pkgconfig\"\n\n" +
-			"# COREUTILS\n" +
-			"#export PATH=\"" + brewPrefix + "opt/coreutils/libexec/gnubin:$PATH\"\n\n" +
-			"# GNU GETOPT\n" +
-			"export PATH=\"" + brewPrefix + "opt/gnu-getopt/bin:$PATH\"\n\n" +
-			"# TCL-TK\n" +
-			"export PATH=\"" + brewPrefix + "opt/tcl-tk/bin:$PATH\"\n" +
-			"export LDFLAGS=\"" + brewPrefix + "opt/tcl-tk/lib\"\n" +
-			"export CPPFLAGS=\"" + brewPrefix + "opt/tcl-tk/include\"\n" +
-			"export PKG_CONFIG_PATH=\"" + brewPrefix + "opt/tcl-tk/lib/pkgconfig\"\n\n" +
-			"# BZIP2\n" +
-			"export PATH=\"" + brewPrefix + "opt/bzip2/bin:$PATH\"\n" +
-			"export LDFLAGS=\"" + brewPrefix + "opt/bzip2/lib\"\n" +
-			"export CPPFLAGS=\"" + brewPrefix + "opt/bzip2/include\"\n\n" +
-			"# BISON\n" +
-			"export PATH=\"" + brewPrefix + "opt/bison/bin:$PATH\"\n" +
-			"export LDFLAGS=\"" + brewPrefix + "opt/bison/lib\"\n\n" +
-			"# ICU4C\n" +
-			"export PATH=\"" + brewPrefix + "opt/icu4c/bin:$PATH\"\n" +
-			"export PATH=\"" + brewPrefix + "opt/icu4c/sbin:$PATH\"\n" +
-			"export LDFLAGS=\"" + brewPrefix + "opt/icu4c/lib\"\n" +
-			"export CPPFLAGS=\"" + brewPrefix + "opt/icu4c/include\"\n" +
-			"export PKG_CONFIG_PATH=\"" + brewPrefix + "opt/icu4c/lib/pkgconfig\"\n\n" +
-			"# DOCBOOK\n" +
-			"export XML_CATALOG_FILES=\"" + brewPrefix + "etc/xml/catalog\"\n\n" +
-			"# LIBICONV\n" +
-			"export PATH=\"" + brewPrefix + "opt/libiconv/bin:$PATH\"\n" +
-			"export LDFLAGS=\"" + brewPrefix + "opt/libiconv/lib\"\n" +
-			"export CPPFLAGS=\"" + brewPrefix + "opt/libiconv/include\"\n\n" +
-			"# LIBXML2\n" +
-			"export PATH=\"" + brewPrefix + "opt/libxml2/bin:$PATH\"\n" +
-			"export LDFLAGS=\"" + brewPrefix + "opt/libxml2/lib\"\n" +
-			"export CPPFLAGS=\"" + brewPrefix + "opt/libxml2/include\"\n" +
-			"export PKG_CONFIG_PATH=\"" + brewPrefix + "opt/libxml2/lib/pkgconfig\"\n\n" +
-			"# LIBXSLT\n" +
-			"export PATH=\"" + brewPrefix + "opt/libxslt/bin:$PATH\"\n" +
-			"export LDFLAGS=\"" + brewPrefix + "opt/libxslt/lib\"\n" +
-			"export CPPFLAGS=\"" + brewPrefix + "opt/libxslt/include\"\n" +
-			"export PKG_CONFIG_PATH=\"" + brewPrefix + "opt/libxslt/lib/pkgconfig\"\n\n" +
-			"# CURL\n" +
-			"export PATH=\"" + brewPrefix + "opt/curl/bin:$PATH\"\n" +
-			"export LDFLAGS=\"" + brewPrefix + "opt/curl/lib\"\n" +
-			"export CPPFLAGS=\"" + brewPrefix + "opt/curl/include\"\n" +
-			"export PKG_CONFIG_PATH=\"" + brewPrefix + "opt/curl/lib/pkgconfig\"\n\n" +
-			"# ZLIB\n" +
-			"export LDFLAGS=\"" + brewPrefix + "opt/zlib/lib\"\n" +
-			"export CPPFLAGS=\"" + brewPrefix + "opt/zlib/include\"\n" +
-			"export PKG_CONFIG_PATH=\"" + brewPrefix + "opt/zlib/lib/pkgconfig\"\n\n"
-		appendContents(shrcPath, shrcAppend, 0644)
+		appendShell(shrcPath, "DOCBOOK", shellrc.Export("XML_CATALOG_FILES", brewPrefix+"etc/xml/catalog"))
+		addBuildFlags("krb5", "tcl-tk", "bzip2", "bison", "icu4c", "libiconv", "libxml2", "libxslt", "curl", "zlib")
 	}
 
 	macLdBar.FinalMSG = lstDot + clrGreen + "Succeed " + clrReset + "install dependencies!\n"
@@ -919,19 +921,16 @@ func macDependency(runOpt string) {
 }
 
 func macTerminal(runOpt string) {
-	macLdBar.Suffix = " Installing zsh with useful tools... "
+	macLdBar.Suffix = " Installing " + userShell + " with useful tools... "
 	macLdBar.Start()
 
-	confA4s()
-	brewInstall("zsh-completions")
-	brewInstall("zsh-syntax-highlighting")
-	brewInstall("zsh-autosuggestions")
+	if userShell == "fish" {
+		brewInstall("fish")
+	}
 	brewInstall("z")
 	brewInstall("tree")
 
 	makeFile(homeDir()+".z", "", 0644)
-	makeDirectory(p10kPath)
-	makeDirectory(p10kCache)
 
 	if runOpt == "5" || runOpt == "6" {
 		brewInstall("fzf")
@@ -943,87 +942,32 @@ func macTerminal(runOpt string) {
 		downloadFile(dliTerm2Conf, "https://raw.githubusercontent.com/leelsey/ConfStore/main/iterm2/iTerm2.plist", 0644)
 	}
 
-	brewRepository("romkatv/powerlevel10k")
-	brewInstall("romkatv/powerlevel10k/powerlevel10k")
-	downloadFile(p10kPath+"p10k-term.zsh", "https://raw.githubusercontent.com/leelsey/ConfStore/main/p10k/p10k-minimalism.zsh", 0644)
-
-	if runOpt == "2" || runOpt == "3" || runOpt == "4" {
-		profileAppend := "# POWERLEVEL10K\n" +
-			"source " + brewPrefix + "opt/powerlevel10k/powerlevel10k.zsh-theme\n" +
-			"if [[ -r \"${XDG_CACHE_HOME:-" + p10kCache + "}/p10k-instant-prompt-${(%):-%n}.zsh\" ]]; then\n" +
-			"  source \"${XDG_CACHE_HOME:-" + p10kCache + "}/p10k-instant-prompt-${(%):-%n}.zsh\"\n" +
-			"fi\n" +
-			"[[ ! -f " + p10kPath + "p10k-terminal.zsh ]] || source " + p10kPath + "p10k-terminal.zsh\n\n"
-		appendContents(prfPath, profileAppend, 0644)
-	} else if runOpt == "5" || runOpt == "6" {
-		downloadFile(p10kPath+"p10k-iterm2.zsh", "https://raw.githubusercontent.com/leelsey/ConfStore/main/p10k/p10k-atelier.zsh", 0644)
-		downloadFile(p10kPath+"p10k-tmux.zsh", "https://raw.githubusercontent.com/leelsey/ConfStore/main/p10k/p10k-seeking.zsh", 0644)
-		downloadFile(p10kPath+"p10k-ops.zsh", "https://raw.githubusercontent.com/leelsey/ConfStore/main/p10k/p10k-operations.zsh", 0644)
-		downloadFile(p10kPath+"p10k-etc.zsh", "https://raw.githubusercontent.com/leelsey/ConfStore/main/p10k/p10k-engineering.zsh", 0644)
-		downloadFile(fontPath+"MesloLGS NF Bold Italic.ttf", "https://raw.githubusercontent.com/romkatv/dotfiles-public/master/.local/share/fonts/NerdFonts/MesloLGS%20NF%20Bold%20Italic.ttf", 0644)
-		downloadFile(fontPath+"MesloLGS NF Bold.ttf", "https://raw.githubusercontent.com/romkatv/dotfiles-public/master/.local/share/fonts/NerdFonts/MesloLGS%20NF%20Bold.ttf", 0644)
-		downloadFile(fontPath+"MesloLGS NF Italic.ttf", "https://raw.githubusercontent.com/romkatv/dotfiles-public/master/.local/share/fonts/NerdFonts/MesloLGS%20NF%20Italic.ttf", 0644)
-		downloadFile(fontPath+"MesloLGS NF Regular.ttf", "https://raw.githubusercontent.com/romkatv/dotfiles-public/master/.local/share/fonts/NerdFonts/MesloLGS%20NF%20Regular.ttf", 0644)
-
-		profileAppend := "# ZSH\n" +
-			"export SHELL=zsh\n\n" +
-			"# POWERLEVEL10K\n" +
-			"source " + brewPrefix + "opt/powerlevel10k/powerlevel10k.zsh-theme\n" +
-			"if [[ -r \"${XDG_CACHE_HOME:-" + p10kCache + "}/p10k-instant-prompt-${(%):-%n}.zsh\" ]]; then\n" +
-			"  source \"${XDG_CACHE_HOME:-" + p10kCache + "}/p10k-instant-prompt-${(%):-%n}.zsh\"\n" +
-			"fi\n" +
-			"if [[ -d /Applications/iTerm.app ]]; then\n" +
-			"  if [[ $TERM_PROGRAM = \"Apple_Terminal\" ]]; then\n" +
-			"    [[ ! -f " + p10kPath + "p10k-term.zsh ]] || source " + p10kPath + "p10k-term.zsh\n" +
-			"  elif [[ $TERM_PROGRAM = \"iTerm.app\" ]]; then\n" +
-			"    [[ ! -f " + p10kPath + "p10k-iterm2.zsh ]] || source " + p10kPath + "p10k-iterm2.zsh\n" +
-			"    echo ''; neofetch --bold off\n" +
-			"  elif [[ $TERM_PROGRAM = \"tmux\" ]]; then\n" +
-			"    [[ ! -f " + p10kPath + "p10k-tmux.zsh ]] || source " + p10kPath + "p10k-tmux.zsh\n" +
-			"    echo ''; neofetch --bold off\n" +
-			"  else\n" +
-			"    [[ ! -f " + p10kPath + "p10k-etc.zsh ]] || source " + p10kPath + "p10k-etc.zsh\n" +
-			"  fi\n" +
-			"else\n" +
-			"  [[ ! -f " + p10kPath + "p10k-term.zsh ]] || source " + p10kPath + "p10k-term.zsh\n" +
-			"fi\n\n"
-		appendContents(prfPath, profileAppend, 0644)
-	}
-
-	profileAppend := "# ZSH-COMPLETIONS\n" +
-		"if type brew &>/dev/null; then\n" +
-		"  FPATH=" + brewPrefix + "share/zsh-completions:$FPATH\n" +
-		"  autoload -Uz compinit\n" +
-		"  compinit\n" +
-		"fi\n\n" +
-		"# ZSH SYNTAX HIGHLIGHTING\n" +
-		"source " + brewPrefix + "share/zsh-syntax-highlighting/zsh-syntax-highlighting.zsh\n\n" +
-		"# ZSH AUTOSUGGESTIONS\n" +
-		"source " + brewPrefix + "share/zsh-autosuggestions/zsh-autosuggestions.zsh\n\n" +
-		"# Z\n" +
-		"source " + brewPrefix + "etc/profile.d/z.sh\n\n" +
-		"# ALIAS4SH\n" +
-		"source " + homeDir() + "/.config/alias4sh/alias4.sh\n\n" +
-		"# Edit\n" +
-		"export EDITOR=/usr/bin/vi\n" +
-		"edit () { $EDITOR \"$@\" }\n" +
-		"#vi () { $EDITOR \"$@\" }\n\n"
-	appendContents(prfPath, profileAppend, 0644)
+	// z is a POSIX shell script, which fish can't source.
+	appendShell(prfPath, "Z", shellrc.Raw("source "+brewPrefix+"etc/profile.d/z.sh", ""))
+	appendShell(prfPath, "Edit",
+		shellrc.Export("EDITOR", "/usr/bin/vi"),
+		shellrc.Raw("edit () { $EDITOR \"$@\"; }\n#vi () { $EDITOR \"$@\"; }", "function edit; $EDITOR $argv; end"))
 
 	macLdBar.FinalMSG = lstDot + clrGreen + "Succeed " + clrReset + "install and configure for terminal!\n"
 	macLdBar.Stop()
+
+	checkError(bootstrap.Run("aliases"), "Failed to write the aliases")
+	// Powerlevel10k and the zsh plugins are zsh only.
+	if userShell == "zsh" {
+		checkError(bootstrap.Run("zsh"), "Failed to install the zsh plugins")
+		checkError(bootstrap.Run("theme", "-backend", "p10k"), "Failed to set the prompt theme")
+		if runOpt == "5" || runOpt == "6" {
+			// A font missing its pin in the manifest leaves the prompt working
+			// with fallback glyphs, so it does not stop the install.
+			checkCmdError(bootstrap.Run("fonts"), "Failed to install the prompt fonts, pin them and run", "dev4os fonts")
+		}
+	}
 }
 
 func macLanguage(runOpt, adminCode string) {
 	macLdBar.Suffix = " Installing computer programming language... "
 	macLdBar.Start()
 
-	shrcAppend := "# CCACHE\n" +
-		"export PATH=\"" + brewPrefix + "opt/ccache/libexec:$PATH\"\n\n" +
-		"# RUBY\n" +
-		"export PATH=\"" + brewPrefix + "opt/ruby/bin:$PATH\"\n"
-	appendContents(shrcPath, shrcAppend, 0644)
-
 	if runOpt == "4" || runOpt == "5" || runOpt == "6" {
 		brewInstall("php")
 		if checkArchitecture() == false {
@@ -1044,17 +988,16 @@ func macLanguage(runOpt, adminCode string) {
 		brewInstall("pyenv")
 		brewInstall("pyenv-virtualenv")
 
-		shrcAppend := "# NVM\n" +
-			"export NVM_DIR=\"$HOME/.nvm\"\n" +
-			"[ -s \"" + brewPrefix + "opt/nvm/nvm.sh\" ] && source \"" + brewPrefix + "opt/nvm/nvm.sh\"\n" +
-			"[ -s \"" + brewPrefix + "opt/nvm/etc/bash_completion.d/nvm\" ] && source \"" +
-			brewPrefix + "opt/nvm/etc/bash_completion.d/nvm\"\n\n" +
-			"# PYENV" +
-			"export PYENV_ROOT=\"$HOME/.pyenv\"\n" +
-			"export PATH=\"$PYENV_ROOT/bin:$PATH\"\n" +
-			"eval \"$(pyenv init --path)\"\n" +
-			"eval \"$(pyenv init -)\"\n\n"
-		appendContents(shrcPath, shrcAppend, 0644)
+		// nvm has no fish support, fish gets pyenv only.
+		appendShell(shrcPath, "NVM",
+			shellrc.Raw("export NVM_DIR=\"$HOME/.nvm\"", ""),
+			shellrc.Raw("[ -s \""+brewPrefix+"opt/nvm/nvm.sh\" ] && source \""+brewPrefix+"opt/nvm/nvm.sh\"", ""),
+			shellrc.Raw("[ -s \""+brewPrefix+"opt/nvm/etc/bash_completion.d/nvm\" ] && source \""+brewPrefix+"opt/nvm/etc/bash_completion.d/nvm\"", ""))
+		appendShell(shrcPath, "PYENV",
+			shellrc.Export("PYENV_ROOT", "$HOME/.pyenv"),
+			shellrc.Path("$PYENV_ROOT/bin"),
+			shellrc.Raw("eval \"$(pyenv init --path)\"", ""),
+			shellrc.Eval("pyenv init -"))
 
 		//nvmIns := exec.Command("nvm", optIns, "--lts")
 		//nvmIns.Stderr = os.Stderr
@@ -1101,12 +1044,7 @@ func macDatabase() {
 	macLdBar.Suffix = " Installing developing tools for database... "
 	macLdBar.Start()
 
-	shrcAppend := "# SQLITE3\n" +
-		"export PATH=\"" + brewPrefix + "opt/sqlite/bin:$PATH\"\n" +
-		"export LDFLAGS=\"" + brewPrefix + "opt/sqlite/lib\"\n" +
-		"export CPPFLAGS=\"" + brewPrefix + "opt/sqlite/include\"\n" +
-		"export PKG_CONFIG_PATH=\"" + brewPrefix + "opt/sqlite/lib/pkgconfig\"\n\n"
-	appendContents(shrcPath, shrcAppend, 0644)
+	addBuildFlags("sqlite")
 
 	brewInstall("sqlite-analyzer")
 	brewInstall("postgresql")
@@ -1125,10 +1063,9 @@ func macDevVM() {
 
 	brewInstall("asdf")
 
-	shrcAppend := "# ASDF VM\n" +
-		"source " + brewPrefix + "opt/asdf/libexec/asdf.sh\n" +
-		"export RUBY_CONFIGURE_OPTS=\"--with-openssl-dir=$(brew --prefix openssl@1.1)\"\n"
-	appendContents(shrcPath, shrcAppend, 0644)
+	appendShell(shrcPath, "ASDF VM",
+		shellrc.Raw("source "+brewPrefix+"opt/asdf/libexec/asdf.sh", "source "+brewPrefix+"opt/asdf/libexec/asdf.fish"),
+		shellrc.Export("RUBY_CONFIGURE_OPTS", "--with-openssl-dir="+brewPrefix+"opt/openssl@1.1"))
 
 	asdfrcContents := "#              _____ _____  ______  __      ____  __ \n" +
 		"#       /\\    / ____|  __ \\|  ____| \\ \\    / /  \\/  |\n" +
@@ -1145,29 +1082,13 @@ func macDevVM() {
 		"java_macos_integration_enable = yes\n"
 	makeFile(homeDir()+".asdfrc", asdfrcContents, 0644)
 
-	asdfInstall("perl", "latest")
-	asdfInstall("ruby", "latest")
-	asdfInstall("python", "latest")
-	asdfInstall("java", "openjdk-11.0.2") // JDK LTS 11
-	asdfInstall("java", "openjdk-17.0.2") // JDK LTS 17
-	asdfInstall("rust", "latest")
-	asdfInstall("golang", "latest")
-	asdfInstall("lua", "latest")
-	asdfInstall("nodejs", "latest")
-	asdfInstall("dart", "latest")
-	asdfInstall("php", "latest")
-	asdfInstall("groovy", "latest")
-	asdfInstall("kotlin", "latest")
-	asdfInstall("scala", "latest")
-	asdfInstall("clojure", "latest")
-	asdfInstall("erlang", "latest")
-	asdfInstall("elixir", "latest")
-	asdfInstall("gleam", "latest")
-	asdfInstall("haskell", "latest")
-	asdfReshim()
-
-	macLdBar.FinalMSG = lstDot + clrGreen + "Succeed " + clrReset + "install ASDF-VM with languages!\n"
+	macLdBar.FinalMSG = lstDot + clrGreen + "Succeed " + clrReset + "install ASDF-VM!\n"
 	macLdBar.Stop()
+
+	// dev4os finds asdf on PATH, which this shell doesn't have before the
+	// new profile is read.
+	os.Setenv("PATH", filepath.Dir(cmdASDF)+":"+os.Getenv("PATH"))
+	checkError(bootstrap.Run("runtimes"), "Failed to install the pinned languages")
 }
 
 func macCLIApp(runOpt string) {
@@ -1194,9 +1115,7 @@ func macCLIApp(runOpt string) {
 		brewInstall("watchman")
 		brewInstall("direnv")
 
-		shrcAppend := "# DIRENV\n" +
-			"eval \"$(direnv hook zsh)\"\n\n"
-		appendContents(shrcPath, shrcAppend, 0644)
+		appendShell(shrcPath, "DIRENV", shellrc.Eval("direnv hook "+userShell))
 	}
 
 	if runOpt == "6" {
@@ -1304,13 +1223,7 @@ func macGUIApp(runOpt, adminCode string) {
 		brewInstallCaskSudo("codeql", "CodeQL", brewPrefix+"Caskroom/Codeql", adminCode)
 	}
 
-	shrcAppend := "# ANDROID STUDIO\n" +
-		"export ANDROID_HOME=$HOME/Library/Android/sdk\n" +
-		"export PATH=$PATH:$ANDROID_HOME/emulator\n" +
-		"export PATH=$PATH:$ANDROID_HOME/tools\n" +
-		"export PATH=$PATH:$ANDROID_HOME/tools/bin\n" +
-		"export PATH=$PATH:$ANDROID_HOME/platform-tools\n\n"
-	appendContents(shrcPath, shrcAppend, 0644)
+	appendShell(shrcPath, "ANDROID STUDIO", shellrc.Export("ANDROID_HOME", "$HOME/Library/Android/sdk"))
 
 	macLdBar.FinalMSG = lstDot + clrGreen + "Succeed " + clrReset + "install GUI applications!\n"
 	macLdBar.Stop()
@@ -1320,7 +1233,7 @@ func macEnd() {
 	macLdBar.Suffix = " Finishing... "
 	macLdBar.Start()
 
-	shrcAppend := "\n######## ADD CUSTOM VALUES UNDER HERE ########\n\n\n"
+	shrcAppend := composeBuildFlags() + composePath() + "\n######## ADD CUSTOM VALUES UNDER HERE ########\n\n\n"
 	appendContents(shrcPath, shrcAppend, 0644)
 
 	brewUpgrade()
@@ -1503,6 +1416,15 @@ func main() {
 
 	runLdBar.Stop()
 
+	if _, err := bootstrap.Path(); err != nil {
+		fmt.Println(errors.New(lstDot + err.Error() + "\n"))
+		goto exitPoint
+	}
+
+	// The dev4os steps write their blocks for the shell this run sets up,
+	// also when it falls back to zsh.
+	os.Setenv("DEV4OS_SHELL", userShell)
+
 	fmt.Println(clrCyan + "The Development tools of Essential and Various for macOS\n" + clrReset +
 		lstDot + "Choose an installation option.\n" + lstDot + "If you need help, visit https://github.com/leelsey/Dev4os.\n" +
 		"\t1. Minimal\n\t2. Basic\n\t3. Creator\n\t4. Beginner\n\t5. Developer\n\t6. Professional\n\t7. Specialist\n\t0. Exit\n")
@@ -1539,6 +1461,11 @@ runOptPoint:
 	}
 	clearLine(12 + tryLoop*2)
 
+	if err := bootstrap.StartBackup("dev4mac"); err != nil {
+		fmt.Println(errors.New(lstDot + err.Error() + "\n"))
+		goto exitPoint
+	}
+
 	if checkPermission(runOpt, brewSts) == true {
 		if adminCode, adminStatus := checkPassword(); adminStatus == true {
 			needPermission(adminCode)
@@ -1553,7 +1480,7 @@ runOptPoint:
 	}
 
 	endMsg = "\n----------Finished!----------\nPlease" + clrRed + " RESTART " + clrReset + "your terminal!\n" +
-		lstDot + "Enter this on terminal: source ~/.zprofile && source ~/.zshrc\n" + lstDot + "Or restart the Terminal.app by yourself.\n"
+		lstDot + "Enter this on terminal: " + sourceHint() + "\n" + lstDot + "Or restart the Terminal.app by yourself.\n"
 	if runOpt == "3" || runOpt == "6" {
 		fmt.Println(endMsg + lstDot + "Also you need " + clrRed + "RESTART macOS " + clrReset + " to apply " + "the changes.\n")
 	} else {
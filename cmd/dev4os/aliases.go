@@ -0,0 +1,229 @@
+package main
+
+import (
+	"dev4os/shellrc"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+var (
+	aliasManagedLine = "# Managed by dev4os, regenerated by \"dev4os aliases\"."
+	// alias4shSections are the headers of the blocks the installers append
+	// to load Alias4sh.
+	alias4shSections = []string{"# ALIAS4SH", "# Alias4sh"}
+	// userAliasPatterns find the aliases and functions a user defines in
+	// bash, zsh or fish.
+	userAliasPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`^\s*alias\s+([^=\s]+)=`),
+		regexp.MustCompile(`^\s*alias\s+([^=\s]+)\s`),
+		regexp.MustCompile(`^\s*(?:function\s+)?([A-Za-z0-9_.:-]+)\s*\(\)`),
+		regexp.MustCompile(`^\s*function\s+([^\s;(]+)`),
+	}
+)
+
+// aliasGroup is one category of the alias catalogue, such as git or docker.
+type aliasGroup struct {
+	Aliases   map[string]string        `json:"aliases"`
+	Functions map[string]shellFunction `json:"functions"`
+}
+
+// shellFunction is a small function too long for an alias, with its body
+// in POSIX syntax for bash and zsh and in fish syntax.
+type shellFunction struct {
+	Posix string `json:"posix"`
+	Fish  string `json:"fish"`
+}
+
+// aliasConflict is a catalogue name that is left out, because a user alias
+// or function, a command or an earlier group already has it.
+type aliasConflict struct {
+	Group  string
+	Name   string
+	Reason string
+}
+
+func aliasPath(userShell shell) string {
+	if userShell.Name() == "fish" {
+		return confDir + "aliases.fish"
+	}
+	return confDir + "aliases.sh"
+}
+
+// userAliases lists the names the user defines outside of the dev4os
+// blocks of the rc files.
+func userAliases() map[string]string {
+	userNames := map[string]string{}
+	rcPaths := []string{fishShell{}.RCPath()}
+	for _, rcFile := range rcFiles {
+		rcPaths = append(rcPaths, homeDir()+rcFile)
+	}
+	for _, rcPath := range rcPaths {
+		userLines, _ := splitManaged(readFileContents(rcPath))
+		for _, userLine := range userLines {
+			for _, aliasPattern := range userAliasPatterns {
+				if aliasMatch := aliasPattern.FindStringSubmatch(userLine); aliasMatch != nil {
+					userNames[aliasMatch[1]] = rcPath
+					break
+				}
+			}
+		}
+	}
+	return userNames
+}
+
+// commandConflict tells whether name would hide a command on PATH. An alias
+// that runs the command it is named after, such as ls='ls -G', does not.
+func commandConflict(name, command string) string {
+	commandPath, err := exec.LookPath(name)
+	if err != nil {
+		return ""
+	} else if commandFields := strings.Fields(command); len(commandFields) > 0 && commandFields[0] == name {
+		return ""
+	}
+	return commandPath
+}
+
+// checkAliases returns the catalogue without the names that conflict, and
+// the conflicts.
+func checkAliases(groups map[string]aliasGroup) (map[string]aliasGroup, []aliasConflict) {
+	var conflicts []aliasConflict
+	userNames := userAliases()
+	definedIn := map[string]string{}
+	keptGroups := map[string]aliasGroup{}
+
+	checkName := func(groupName, name, command string) bool {
+		reason := ""
+		if rcPath, ok := userNames[name]; ok == true {
+			reason = "defined by you in \"" + rcPath + "\""
+		} else if otherGroup, ok := definedIn[name]; ok == true {
+			reason = "already in group " + otherGroup
+		} else if commandPath := commandConflict(name, command); commandPath != "" {
+			reason = "hides the command " + commandPath
+		}
+		if reason != "" {
+			conflicts = append(conflicts, aliasConflict{groupName, name, reason})
+			return false
+		}
+		definedIn[name] = groupName
+		return true
+	}
+
+	for _, groupName := range sortedKeys(groups) {
+		keptGroup := aliasGroup{map[string]string{}, map[string]shellFunction{}}
+		for _, name := range sortedKeys(groups[groupName].Aliases) {
+			if checkName(groupName, name, groups[groupName].Aliases[name]) == true {
+				keptGroup.Aliases[name] = groups[groupName].Aliases[name]
+			}
+		}
+		for _, name := range sortedKeys(groups[groupName].Functions) {
+			if checkName(groupName, name, "") == true {
+				keptGroup.Functions[name] = groups[groupName].Functions[name]
+			}
+		}
+		keptGroups[groupName] = keptGroup
+	}
+	return keptGroups, conflicts
+}
+
+func renderFunction(userShell shell, name string, function shellFunction) string {
+	body := function.Posix
+	if userShell.Name() == "fish" {
+		body = function.Fish
+	}
+	var bodyLines []string
+	for _, bodyLine := range strings.Split(strings.TrimRight(body, "\n"), "\n") {
+		bodyLines = append(bodyLines, "  "+bodyLine)
+	}
+	if userShell.Name() == "fish" {
+		return "function " + name + "\n" + strings.Join(bodyLines, "\n") + "\nend"
+	}
+	return name + "() {\n" + strings.Join(bodyLines, "\n") + "\n}"
+}
+
+// renderAliases writes every group under a comment with its name, aliases
+// first and then functions. A function without a body for the shell is
+// left out of it.
+func renderAliases(userShell shell, groups map[string]aliasGroup) string {
+	aliasFile := aliasManagedLine + "\n"
+	for _, groupName := range sortedKeys(groups) {
+		var groupLines []shellrc.Line
+		for _, name := range sortedKeys(groups[groupName].Aliases) {
+			groupLines = append(groupLines, shellrc.Alias(name, groups[groupName].Aliases[name]))
+		}
+		for _, name := range sortedKeys(groups[groupName].Functions) {
+			function := groups[groupName].Functions[name]
+			if (userShell.Name() == "fish" && function.Fish != "") || (userShell.Name() != "fish" && function.Posix != "") {
+				groupLines = append(groupLines, shellrc.Raw(renderFunction(userShell, name, function), renderFunction(userShell, name, function)))
+			}
+		}
+		if len(groupLines) > 0 {
+			aliasFile += "\n# " + groupName + "\n" + renderSnippet(userShell, groupLines...)
+		}
+	}
+	return aliasFile
+}
+
+func printAliasConflicts(conflicts []aliasConflict) {
+	for _, conflict := range conflicts {
+		fmt.Println(clrYellow + "  ~ " + clrReset + conflict.Group + "/" + conflict.Name + " " + clrGrey + conflict.Reason + clrReset)
+	}
+}
+
+// confAliases writes the catalogue for bash and zsh and for fish, sources
+// the file of the login shell from its rc file and drops the lines that
+// loaded Alias4sh.
+func confAliases() {
+	groups, conflicts := checkAliases(loadManifest().Aliases)
+	fmt.Println(clrCyan + "Aliases" + clrReset)
+	for _, groupName := range sortedKeys(groups) {
+		fmt.Println(clrGreen + "  + " + clrReset + groupName + " " + clrGrey +
+			fmt.Sprint(len(groups[groupName].Aliases)) + " aliases, " + fmt.Sprint(len(groups[groupName].Functions)) + " functions" + clrReset)
+	}
+	printAliasConflicts(conflicts)
+
+	makeDirectory(confDir)
+	for _, aliasShell := range []shell{zshShell{}, fishShell{}} {
+		makeFile(aliasPath(aliasShell), renderAliases(aliasShell, groups), 0644)
+	}
+	userShell := loginShell()
+	writeManagedBlock(userShell.RCPath(), "aliases", renderSnippet(userShell, shellrc.Source(homeShellPath(aliasPath(userShell)))), 0644)
+
+	if oldLines := findRCSections(alias4shSections); len(oldLines) > 0 {
+		for _, oldLine := range oldLines {
+			fmt.Println(clrRed + "  - " + clrReset + oldLine.Path + ":" + fmt.Sprint(oldLine.Num) + clrGrey + "  " + oldLine.Text + clrReset)
+		}
+		if removeRCLines(oldLines) == true {
+			fmt.Println(lstDot + "Alias4sh is no longer loaded, \"" + homeDir() + ".config/alias4sh\" can be removed.")
+		} else {
+			fmt.Println(clrYellow + "  ~ " + clrReset + "Remove the Alias4sh lines listed above by hand.")
+		}
+	}
+	fmt.Println(lstDot + "Aliases written to \"" + aliasPath(userShell) + "\" and loaded from \"" + userShell.RCPath() + "\".")
+}
+
+func listAliases() {
+	groups, conflicts := checkAliases(loadManifest().Aliases)
+	for _, groupName := range sortedKeys(groups) {
+		fmt.Println(clrCyan + groupName + clrReset)
+		for _, name := range sortedKeys(groups[groupName].Aliases) {
+			fmt.Println("  " + name + clrGrey + " = " + groups[groupName].Aliases[name] + clrReset)
+		}
+		for _, name := range sortedKeys(groups[groupName].Functions) {
+			fmt.Println("  " + name + clrGrey + " ()" + clrReset)
+		}
+	}
+	printAliasConflicts(conflicts)
+}
+
+func aliasesMain(args []string) {
+	if len(args) == 0 {
+		confAliases()
+	} else if args[0] == "list" {
+		listAliases()
+	} else {
+		printUsage()
+		messageError("fatal", "Unknown aliases command \""+args[0]+"\"", "Usage")
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	backupDir = stateDir + "backups/"
+	// runBackup is the backup set of this run. It is made on the first
+	// snapshot, so a run that changes nothing leaves no set behind.
+	runBackup   = backupSet{}
+	snapshotted = map[string]string{}
+)
+
+// backupEntry is one file as it was before the run changed it. A file the
+// run created has no copy and is removed on restore, and a symbolic link is
+// kept as its target.
+type backupEntry struct {
+	Path    string      `json:"path"`
+	Mode    os.FileMode `json:"mode,omitempty"`
+	Link    string      `json:"link,omitempty"`
+	Created bool        `json:"created,omitempty"`
+}
+
+// backupSet is every file one run of dev4os changed, in the order it changed
+// them, with the command that ran. The set of an installer run also holds the
+// files of the dev4os steps the installer ran.
+type backupSet struct {
+	Run       string        `json:"run"`
+	Command   string        `json:"command"`
+	Installer string        `json:"installer,omitempty"`
+	Files     []backupEntry `json:"files"`
+}
+
+func (set backupSet) title() string {
+	if set.Installer != "" {
+		return set.Installer
+	}
+	return "dev4os " + set.Command
+}
+
+func backupCopyPath(run, filePath string) string {
+	return backupDir + run + "/files" + filePath
+}
+
+// newRunID names the backup set of this run by its start time, with a count
+// when another run started in the same second.
+func newRunID() string {
+	runID := time.Now().Format("20060102-150405")
+	for runNum := 2; checkExists(backupDir+runID) == true; runNum++ {
+		runID = time.Now().Format("20060102-150405") + "-" + fmt.Sprint(runNum)
+	}
+	return runID
+}
+
+// startBackupSet names the backup set of this run. Under an installer,
+// $DEV4OS_BACKUP_RUN names the set of the installer run, and the files already
+// in it are not saved again.
+func startBackupSet() {
+	if runBackup.Run != "" {
+		return
+	} else if runID := os.Getenv("DEV4OS_BACKUP_RUN"); runID != "" {
+		runBackup = loadBackupSet(runID)
+		for _, entry := range runBackup.Files {
+			snapshotted[entry.Path] = ""
+			if entry.Created != true && entry.Link == "" {
+				snapshotted[entry.Path] = backupCopyPath(runID, entry.Path)
+			}
+		}
+		return
+	}
+	runBackup = backupSet{Run: newRunID(), Command: strings.Join(os.Args[1:], " ")}
+}
+
+// newInstallerSet starts the backup set of an installer run and prints its
+// ID, which the installer passes on in $DEV4OS_BACKUP_RUN.
+func newInstallerSet(args []string) {
+	if len(args) != 1 {
+		messageError("fatal", "Usage: dev4os backups new <installer>", "Usage")
+	}
+	runBackup = backupSet{Run: newRunID(), Installer: args[0]}
+	makeDirectory(backupDir + runBackup.Run)
+	saveState("backups/"+runBackup.Run+"/index.json", runBackup)
+	fmt.Println(runBackup.Run)
+}
+
+// backupRunPath is where a backup of something that is not a file, such as
+// a dconf dump, goes in the backup set of this run.
+func backupRunPath(name string) string {
+	startBackupSet()
+	makeDirectory(backupDir + runBackup.Run)
+	return backupDir + runBackup.Run + "/" + name
+}
+
+// snapshotFile saves filePath into the backup set of this run before the
+// first change to it, and returns where the copy is. The state of dev4os and
+// its own temporary files are not saved.
+func snapshotFile(filePath string) string {
+	absPath, err := filepath.Abs(filePath)
+	checkError(err, "Failed to find \""+filePath+"\"")
+	if strings.HasPrefix(absPath, stateDir) || strings.HasPrefix(absPath, filepath.Join(os.TempDir(), "dev4os-")) {
+		return ""
+	}
+	startBackupSet()
+	if copyPath, ok := snapshotted[absPath]; ok == true {
+		return copyPath
+	}
+
+	entry := backupEntry{Path: absPath}
+	copyPath := ""
+	if fileInfo, err := os.Lstat(absPath); err != nil {
+		entry.Created = true
+	} else if fileInfo.Mode()&os.ModeSymlink != 0 {
+		entry.Link, _ = os.Readlink(absPath)
+	} else if fileInfo.IsDir() == true {
+		return ""
+	} else {
+		entry.Mode = fileInfo.Mode().Perm()
+		copyPath = backupCopyPath(runBackup.Run, absPath)
+		makeDirectory(filepath.Dir(copyPath))
+		makeFile(copyPath, readFileContents(absPath), int(entry.Mode))
+	}
+	snapshotted[absPath] = copyPath
+	runBackup.Files = append(runBackup.Files, entry)
+	makeDirectory(backupDir + runBackup.Run)
+	saveState("backups/"+runBackup.Run+"/index.json", runBackup)
+	return copyPath
+}
+
+// runOrder splits a run ID into its start time and its count among the runs
+// of the same second, so "-10" sorts after "-2".
+func runOrder(runID string) (string, int) {
+	startTime, runNum := runID, 1
+	if len(runID) > 16 && runID[15] == '-' {
+		startTime = runID[:15]
+		runNum, _ = strconv.Atoi(runID[16:])
+	}
+	return startTime, runNum
+}
+
+// backupSets lists the runs with a backup set, oldest first.
+func backupSets() []string {
+	var runIDs []string
+	runDirs, _ := os.ReadDir(backupDir)
+	for _, runDir := range runDirs {
+		if runDir.IsDir() == true && checkExists(backupDir+runDir.Name()+"/index.json") == true {
+			runIDs = append(runIDs, runDir.Name())
+		}
+	}
+	sort.Slice(runIDs, func(i, j int) bool {
+		iTime, iNum := runOrder(runIDs[i])
+		jTime, jNum := runOrder(runIDs[j])
+		if iTime != jTime {
+			return iTime < jTime
+		}
+		return iNum < jNum
+	})
+	return runIDs
+}
+
+func loadBackupSet(runID string) backupSet {
+	if checkExists(backupDir+runID+"/index.json") != true {
+		messageError("fatal", "No backup set \""+runID+"\", run \"dev4os backups\" to list them", "Restore")
+	}
+	set := backupSet{}
+	loadState("backups/"+runID+"/index.json", &set)
+	return set
+}
+
+// restoreEntry puts one file back the way the backup set has it. What is
+// there now is snapshotted first, so a restore can be undone too.
+func restoreEntry(runID string, entry backupEntry) {
+	if fileInfo, err := os.Lstat(entry.Path); err == nil && (entry.Created == true || fileInfo.Mode()&os.ModeSymlink != 0) {
+		snapshotFile(entry.Path)
+		checkError(os.Remove(entry.Path), "Failed to remove \""+entry.Path+"\"")
+	}
+	if entry.Created == true {
+		fmt.Println(clrRed + "  - " + clrReset + entry.Path)
+		return
+	}
+	makeDirectory(filepath.Dir(entry.Path))
+	if entry.Link != "" {
+		linkFile(entry.Link, entry.Path)
+	} else {
+		makeFile(entry.Path, readFileContents(backupCopyPath(runID, entry.Path)), int(entry.Mode))
+	}
+	fmt.Println(clrYellow + "  ~ " + clrReset + entry.Path)
+}
+
+// restoreBackup rolls the files of one backup set back, the newest set when
+// no run is given.
+func restoreBackup(args []string) {
+	restoreFlags := flag.NewFlagSet("restore", flag.ExitOnError)
+	runID := restoreFlags.String("run", "", "backup set to restore, the newest by default")
+	filePath := restoreFlags.String("file", "", "restore only this file")
+	assumeYes := restoreFlags.Bool("yes", false, "restore without asking")
+	checkError(restoreFlags.Parse(args), "Failed to parse restore options")
+
+	if *runID == "" {
+		runIDs := backupSets()
+		if len(runIDs) == 0 {
+			messageError("fatal", "No backup sets in \""+backupDir+"\"", "Restore")
+		}
+		*runID = runIDs[len(runIDs)-1]
+	}
+	if *filePath != "" {
+		absPath, err := filepath.Abs(expandHome(*filePath))
+		checkError(err, "Failed to find \""+*filePath+"\"")
+		*filePath = absPath
+	}
+	set := loadBackupSet(*runID)
+	var entries []backupEntry
+	for _, entry := range set.Files {
+		if *filePath == "" || entry.Path == *filePath {
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) == 0 {
+		messageError("fatal", "Backup set "+*runID+" has no \""+*filePath+"\"", "Restore")
+	}
+
+	fmt.Println(clrCyan + "Restore " + *runID + clrReset + clrGrey + "  " + set.title() + clrReset)
+	for _, entry := range entries {
+		if entry.Created == true {
+			fmt.Println(lstDot + "remove  " + entry.Path)
+		} else {
+			fmt.Println(lstDot + "restore " + entry.Path)
+		}
+	}
+	if *assumeYes != true && answerYes(readInput("If you wish to continue type (Y) then press return: ")) != true {
+		fmt.Println(lstDot + "Restore cancelled.")
+		return
+	}
+	for _, entry := range entries {
+		restoreEntry(*runID, entry)
+	}
+	if runBackup.Run != "" {
+		fmt.Println(lstDot + "Restored. The files as they were are in backup set " + runBackup.Run + ".")
+	}
+}
+
+func listBackups() {
+	fmt.Println(clrCyan + "Backups" + clrReset + " in \"" + backupDir + "\"")
+	runIDs := backupSets()
+	for runNum := len(runIDs) - 1; runNum >= 0; runNum-- {
+		set := loadBackupSet(runIDs[runNum])
+		fmt.Println("  " + set.Run + clrGrey + "  " + set.title() + ", " + fmt.Sprint(len(set.Files)) + " files" + clrReset)
+	}
+	if len(runIDs) == 0 {
+		fmt.Println(lstDot + "No backup sets yet.")
+	}
+}
+
+// pruneBackups removes every backup set but the newest ones.
+func pruneBackups(args []string) {
+	pruneFlags := flag.NewFlagSet("backups prune", flag.ExitOnError)
+	keep := pruneFlags.Int("keep", 10, "number of newest backup sets to keep")
+	checkError(pruneFlags.Parse(args), "Failed to parse backups prune options")
+	if *keep < 0 {
+		messageError("fatal", "Can't keep less than 0 backup sets", "Backups")
+	}
+
+	runIDs := backupSets()
+	fmt.Println(clrCyan + "Prune backups" + clrReset + ", keeping the newest " + fmt.Sprint(*keep))
+	for runNum := 0; runNum < len(runIDs)-*keep; runNum++ {
+		checkError(os.RemoveAll(backupDir+runIDs[runNum]), "Failed to remove backup set \""+runIDs[runNum]+"\"")
+		fmt.Println(clrRed + "  - " + clrReset + runIDs[runNum])
+	}
+}
+
+func backupsMain(args []string) {
+	if len(args) == 0 {
+		listBackups()
+	} else if args[0] == "prune" {
+		pruneBackups(args[1:])
+	} else if args[0] == "new" {
+		newInstallerSet(args[1:])
+	} else if args[0] == "snapshot" {
+		for _, filePath := range args[1:] {
+			snapshotFile(filePath)
+		}
+	} else {
+		printUsage()
+		messageError("fatal", "Unknown backups command \""+args[0]+"\"", "Usage")
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBackupSetsOrder(t *testing.T) {
+	oldBackupDir := backupDir
+	backupDir = t.TempDir() + "/"
+	defer func() { backupDir = oldBackupDir }()
+
+	// A run ID is the start time, with a count for the later runs of the
+	// same second.
+	wantIDs := []string{"20260101-090000", "20260101-120000", "20260101-120000-2", "20260101-120000-10", "20260102-080000"}
+	for _, runID := range []string{"20260101-120000-10", "20260102-080000", "20260101-120000", "20260101-120000-2", "20260101-090000"} {
+		if err := os.MkdirAll(filepath.Join(backupDir, runID), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(backupDir, runID, "index.json"), []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(backupDir, "20260103-000000"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if runIDs := backupSets(); strings.Join(runIDs, " ") != strings.Join(wantIDs, " ") {
+		t.Fatalf("backupSets() = %v, want %v", runIDs, wantIDs)
+	}
+}
+
+func TestBackupRoundTrip(t *testing.T) {
+	oldStateDir, oldBackupDir := stateDir, backupDir
+	stateDir = t.TempDir() + "/"
+	backupDir = stateDir + "backups/"
+	runBackup, snapshotted = backupSet{}, map[string]string{}
+	defer func() {
+		stateDir, backupDir = oldStateDir, oldBackupDir
+		runBackup, snapshotted = backupSet{}, map[string]string{}
+	}()
+	t.Setenv("DEV4OS_BACKUP_RUN", "")
+
+	homePath := t.TempDir()
+	rcPath := filepath.Join(homePath, ".bashrc")
+	newPath := filepath.Join(homePath, ".config", "dev4os", "aliases.sh")
+	linkPath := filepath.Join(homePath, ".gitconfig")
+	if err := os.WriteFile(rcPath, []byte("export EDITOR=vi\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("dotfiles/gitconfig", linkPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each file is snapshotted once, so the second snapshot of the rc file
+	// keeps the first copy.
+	for _, filePath := range []string{rcPath, newPath, linkPath, rcPath} {
+		snapshotFile(filePath)
+	}
+	if err := os.WriteFile(rcPath, []byte("export EDITOR=nano\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(newPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(newPath, []byte("alias ll='ls -l'\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(linkPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(linkPath, []byte("[user]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	set := loadBackupSet(runBackup.Run)
+	if len(set.Files) != 3 {
+		t.Fatalf("backup set has %d files, want 3: %+v", len(set.Files), set.Files)
+	}
+	runID := runBackup.Run
+	runBackup, snapshotted = backupSet{}, map[string]string{}
+	for _, entry := range set.Files {
+		restoreEntry(runID, entry)
+	}
+
+	if rcContents, err := os.ReadFile(rcPath); err != nil || string(rcContents) != "export EDITOR=vi\n" {
+		t.Errorf("restored %s = %q, %v, want the old contents", rcPath, rcContents, err)
+	}
+	if rcInfo, err := os.Stat(rcPath); err != nil {
+		t.Error(err)
+	} else if rcInfo.Mode().Perm() != 0600 {
+		t.Errorf("restored %s mode = %v, want 0600", rcPath, rcInfo.Mode().Perm())
+	}
+	if _, err := os.Lstat(newPath); os.IsNotExist(err) != true {
+		t.Errorf("%s was created by the run and is still there after restore", newPath)
+	}
+	if linkTarget, err := os.Readlink(linkPath); err != nil || linkTarget != "dotfiles/gitconfig" {
+		t.Errorf("restored %s links to %q, %v, want dotfiles/gitconfig", linkPath, linkTarget, err)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Managed blocks are the parts of a user's file owned by dev4os. Everything
+// between the begin and end markers is regenerated on each run, and every
+// line outside of them belongs to the user and is kept as it is.
+
+func blockBegin(name string) string {
+	return "# >>> dev4os " + name + " >>>"
+}
+
+func blockEnd(name string) string {
+	return "# <<< dev4os " + name + " <<<"
+}
+
+func renderBlock(name, body string) string {
+	return blockBegin(name) + "\n" + strings.TrimRight(body, "\n") + "\n" + blockEnd(name) + "\n"
+}
+
+// splitManaged separates contents into the lines outside of any managed block
+// and the body of each block by name.
+func splitManaged(contents string) ([]string, map[string]string) {
+	var userLines []string
+	blocks := map[string]string{}
+	blockName := ""
+	if contents == "" {
+		return nil, blocks
+	}
+	for _, fileLine := range strings.Split(strings.TrimRight(contents, "\n"), "\n") {
+		if blockName == "" && strings.HasPrefix(fileLine, "# >>> dev4os ") && strings.HasSuffix(fileLine, " >>>") {
+			blockName = strings.TrimSuffix(strings.TrimPrefix(fileLine, "# >>> dev4os "), " >>>")
+			blocks[blockName] = ""
+		} else if blockName != "" && fileLine == blockEnd(blockName) {
+			blockName = ""
+		} else if blockName != "" {
+			blocks[blockName] += fileLine + "\n"
+		} else {
+			userLines = append(userLines, fileLine)
+		}
+	}
+	return userLines, blocks
+}
+
+// lineBlocks returns the name of the managed block each line of contents
+// belongs to, with "" for the user's lines. Markers belong to their block.
+func lineBlocks(contents string) []string {
+	var lineNames []string
+	blockName := ""
+	for _, fileLine := range strings.Split(strings.TrimRight(contents, "\n"), "\n") {
+		if blockName == "" && strings.HasPrefix(fileLine, "# >>> dev4os ") && strings.HasSuffix(fileLine, " >>>") {
+			blockName = strings.TrimSuffix(strings.TrimPrefix(fileLine, "# >>> dev4os "), " >>>")
+			lineNames = append(lineNames, blockName)
+		} else if blockName != "" && fileLine == blockEnd(blockName) {
+			lineNames = append(lineNames, blockName)
+			blockName = ""
+		} else {
+			lineNames = append(lineNames, blockName)
+		}
+	}
+	return lineNames
+}
+
+func readFileContents(filePath string) string {
+	if checkExists(filePath) != true {
+		return ""
+	}
+	fileContents, err := os.ReadFile(filePath)
+	checkError(err, "Failed to read \""+filePath+"\"")
+	return string(fileContents)
+}
+
+// replaceBlock returns contents with the named block set to body, in place when
+// the block already exists and appended at the end otherwise.
+func replaceBlock(contents, name, body string) string {
+	newBlock := renderBlock(name, body)
+	if contents != "" && strings.HasSuffix(contents, "\n") != true {
+		contents += "\n"
+	}
+	beginAt := strings.Index(contents, blockBegin(name)+"\n")
+	endAt := strings.Index(contents, blockEnd(name)+"\n")
+	if beginAt >= 0 && endAt > beginAt {
+		return contents[:beginAt] + newBlock + contents[endAt+len(blockEnd(name))+1:]
+	}
+	if contents != "" {
+		contents += "\n"
+	}
+	return contents + newBlock
+}
+
+func writeManagedBlock(filePath, name, body string, fileMode int) {
+	makeDirectory(filepath.Dir(filePath))
+	makeFile(filePath, replaceBlock(readFileContents(filePath), name, body), fileMode)
+}
+
+// writeFirstBlock is writeManagedBlock for a block that has to run before the
+// rest of the file, such as the p10k instant prompt. A new block goes on top
+// and an existing one stays where it is.
+func writeFirstBlock(filePath, name, body string, fileMode int) {
+	contents := readFileContents(filePath)
+	if strings.Contains(contents, blockBegin(name)+"\n") != true && contents != "" {
+		contents = renderBlock(name, body) + "\n" + contents
+	}
+	makeDirectory(filepath.Dir(filePath))
+	makeFile(filePath, replaceBlock(contents, name, body), fileMode)
+}
+
+// removeBlock returns contents without the named block and the blank line
+// replaceBlock put before it, or after it for a block on top of the file.
+func removeBlock(contents, name string) string {
+	beginAt := strings.Index(contents, blockBegin(name)+"\n")
+	endAt := strings.Index(contents, blockEnd(name)+"\n")
+	if beginAt < 0 || endAt < beginAt {
+		return contents
+	}
+	before := contents[:beginAt]
+	after := contents[endAt+len(blockEnd(name))+1:]
+	if strings.HasSuffix(before, "\n\n") {
+		before = before[:len(before)-1]
+	} else if before == "" {
+		after = strings.TrimPrefix(after, "\n")
+	}
+	return before + after
+}
@@ -0,0 +1,87 @@
+// Package bootstrap lets the dev4mac, dev4deb and dev4rpm installers hand a
+// step to the dev4os command, so a machine set up by an installer gets the
+// same pinned plugins, theme, aliases and runtimes as one set up by dev4os.
+// The files an installer writes go into the dev4os backup set of its run.
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Path finds the dev4os command on PATH or in the bin directory "go install"
+// puts it in. The installers check it before they change anything, since
+// several of their steps are dev4os commands.
+func Path() (string, error) {
+	if dev4osPath, err := exec.LookPath("dev4os"); err == nil {
+		return dev4osPath, nil
+	}
+	goBin := os.Getenv("GOBIN")
+	if goBin == "" {
+		goPath := os.Getenv("GOPATH")
+		if goPath == "" {
+			homeDir, _ := os.UserHomeDir()
+			goPath = filepath.Join(homeDir, "go")
+		}
+		goBin = filepath.Join(goPath, "bin")
+	}
+	if dev4osInfo, err := os.Stat(filepath.Join(goBin, "dev4os")); err == nil && dev4osInfo.Mode()&0111 != 0 {
+		return filepath.Join(goBin, "dev4os"), nil
+	}
+	return "", errors.New("dev4os is not installed, run \"go install .\" in cmd/dev4os of the Dev4os repository first")
+}
+
+// Run runs "dev4os args" on the terminal, so its questions and output reach
+// the user, and fails when dev4os is missing or fails.
+func Run(args ...string) error {
+	dev4osPath, err := Path()
+	if err != nil {
+		return err
+	}
+	dev4osCmd := exec.Command(dev4osPath, args...)
+	dev4osCmd.Stdin = os.Stdin
+	dev4osCmd.Stdout = os.Stdout
+	dev4osCmd.Stderr = os.Stderr
+	if err := dev4osCmd.Run(); err != nil {
+		return fmt.Errorf("dev4os %s: %w", strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// StartBackup starts one backup set for the whole installer run and passes
+// it on in $DEV4OS_BACKUP_RUN, so the files the installer writes and the ones
+// its dev4os steps write are restored together by "dev4os restore".
+func StartBackup(installer string) error {
+	dev4osPath, err := Path()
+	if err != nil {
+		return err
+	}
+	runID, err := exec.Command(dev4osPath, "backups", "new", installer).Output()
+	if err != nil {
+		return fmt.Errorf("dev4os backups new: %w", err)
+	}
+	return os.Setenv("DEV4OS_BACKUP_RUN", strings.TrimSpace(string(runID)))
+}
+
+// Snapshot saves filePaths into the backup set of the run before the
+// installer changes them. A file that does not exist yet is recorded as
+// created, so a restore removes it.
+func Snapshot(filePaths ...string) error {
+	if os.Getenv("DEV4OS_BACKUP_RUN") == "" {
+		return errors.New("no backup set for this run, call StartBackup first")
+	}
+	dev4osPath, err := Path()
+	if err != nil {
+		return err
+	}
+	snapshotCmd := exec.Command(dev4osPath, append([]string{"backups", "snapshot"}, filePaths...)...)
+	snapshotCmd.Stderr = os.Stderr
+	if err := snapshotCmd.Run(); err != nil {
+		return fmt.Errorf("dev4os backups snapshot %s: %w", strings.Join(filePaths, " "), err)
+	}
+	return nil
+}
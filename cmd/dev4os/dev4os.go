@@ -1 +1,278 @@
-package dev4os
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/user"
+	"strings"
+)
+
+var (
+	appVer    = "0.5"
+	lstDot    = " • "
+	cmdGit    = "git"
+	gitDir    = homeDir() + ".config/git/"
+	sshDir    = homeDir() + ".ssh/"
+	clrReset  = "\033[0m"
+	clrRed    = "\033[31m"
+	clrGreen  = "\033[32m"
+	clrYellow = "\033[33m"
+	clrBlue   = "\033[34m"
+	clrPurple = "\033[35m"
+	clrCyan   = "\033[36m"
+	clrGrey   = "\033[37m"
+	stdinScan = bufio.NewScanner(os.Stdin)
+)
+
+func messageError(handling, msg, code string) {
+	errOccurred := clrRed + "\nError occurred " + clrReset + "at "
+	errMsgFormat := "\n" + clrRed + "Error >> " + clrReset + msg + " (" + code + ")\n"
+	if handling == "fatal" || handling == "stop" {
+		fmt.Print(errors.New("\n" + lstDot + "Fatal error" + errOccurred))
+		log.Fatalln(errMsgFormat)
+	} else if handling == "print" || handling == "continue" {
+		log.Println(errMsgFormat)
+	} else if handling == "panic" || handling == "detail" {
+		fmt.Print(errors.New("\n" + lstDot + "Panic error" + errOccurred))
+		panic(errMsgFormat)
+	} else {
+		fmt.Print(errors.New("\n" + lstDot + "Unknown error" + errOccurred))
+		log.Fatalln(errMsgFormat)
+	}
+}
+
+func checkError(err error, msg string) {
+	if err != nil {
+		messageError("fatal", msg, err.Error())
+	}
+}
+
+func checkCmdError(err error, msg, pkg string) {
+	if err != nil {
+		messageError("print", msg+" "+clrYellow+pkg+clrReset, err.Error())
+	}
+}
+
+func checkExists(path string) bool {
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		return true
+	} else {
+		return false
+	}
+}
+
+func homeDir() string {
+	homeDirPath, err := os.UserHomeDir()
+	checkError(err, "Failed to get home directory")
+	return homeDirPath + "/"
+}
+
+func userName() string {
+	workingUser, err := user.Current()
+	checkError(err, "Failed to get current user")
+	return workingUser.Username
+}
+
+func makeDirectory(dirPath string) {
+	if checkExists(dirPath) != true {
+		err := os.MkdirAll(dirPath, 0755)
+		checkError(err, "Failed to make directory")
+	}
+}
+
+func makeFile(filePath, fileContents string, fileMode int) {
+	snapshotFile(filePath)
+	targetFile, err := os.OpenFile(filePath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, os.FileMode(fileMode))
+	checkError(err, "Failed to get file information to make new file from \""+filePath+"\"")
+
+	defer func() {
+		err := targetFile.Close()
+		checkError(err, "Failed to finish make file to \""+filePath+"\"")
+	}()
+
+	_, err = targetFile.Write([]byte(fileContents))
+	checkError(err, "Failed to fill in information to \""+filePath+"\"")
+}
+
+// linkFile points dstPath to srcPath with a symbolic link, in place of the
+// file or link that was there.
+func linkFile(srcPath, dstPath string) {
+	snapshotFile(dstPath)
+	if _, err := os.Lstat(dstPath); err == nil {
+		checkError(os.Remove(dstPath), "Failed to remove \""+dstPath+"\"")
+	}
+	checkError(os.Symlink(srcPath, dstPath), "Failed to symbolic link \""+srcPath+"\"->\""+dstPath+"\"")
+}
+
+func netHTTP(urlPath string) string {
+	resp, err := http.Get(urlPath)
+	checkError(err, "Failed to connect "+urlPath)
+
+	defer func() {
+		errBodyClose := resp.Body.Close()
+		checkError(errBodyClose, "Failed to download from "+urlPath)
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		messageError("fatal", "Failed to download from "+urlPath, resp.Status)
+	}
+	rawFile, err := io.ReadAll(resp.Body)
+	checkError(err, "Failed to read file information from "+urlPath)
+	return string(rawFile)
+}
+
+func downloadFile(filePath, urlPath string, fileMode int) {
+	makeFile(filePath, netHTTP(urlPath), fileMode)
+}
+
+func expandHome(path string) string {
+	if path == "~" {
+		return strings.TrimSuffix(homeDir(), "/")
+	} else if strings.HasPrefix(path, "~/") {
+		return homeDir() + path[2:]
+	}
+	return path
+}
+
+func readInput(question string) string {
+	fmt.Print(question)
+	stdinScan.Scan()
+	return strings.TrimSpace(stdinScan.Text())
+}
+
+func answerYes(answer string) bool {
+	return answer == "y" || answer == "Y" || answer == "yes" || answer == "Yes" || answer == "YES"
+}
+
+func gitConfigGet(key string) string {
+	getConf := exec.Command(cmdGit, "config", "--global", "--get", key)
+	confValue, _ := getConf.Output()
+	return strings.TrimSpace(string(confValue))
+}
+
+func gitRepoConfigGet(repoDir, key string) string {
+	getConf := exec.Command(cmdGit, "-C", repoDir, "config", "--get", key)
+	confValue, _ := getConf.Output()
+	return strings.TrimSpace(string(confValue))
+}
+
+// gitGlobalPath is the file "git config --global" writes to.
+func gitGlobalPath() string {
+	if globalPath := os.Getenv("GIT_CONFIG_GLOBAL"); globalPath != "" {
+		return globalPath
+	} else if checkExists(homeDir()+".gitconfig") != true && checkExists(gitDir+"config") == true {
+		return gitDir + "config"
+	}
+	return homeDir() + ".gitconfig"
+}
+
+func gitConfigSet(key, value string) {
+	snapshotFile(gitGlobalPath())
+	setConf := exec.Command(cmdGit, "config", "--global", key, value)
+	err := setConf.Run()
+	checkError(err, "Failed to set git config \""+key+"\"")
+}
+
+func printUsage() {
+	fmt.Println(clrBlue + "\nDev4os\n" + clrGrey + "Dev4os version " + appVer + clrReset + "\n\n" +
+		"Usage: dev4os <command> [options]\n\n" +
+		"Commands:\n" +
+		"\tgit              Configure git global (user, defaults, ignore and signing)\n" +
+		"\tgit signing      Configure commit and tag signing with SSH or GPG key\n" +
+		"\tgit ignore       Compose global gitignore from OS, editor and language templates\n" +
+		"\tgit defaults     Apply git config groups enabled by the selected profile\n" +
+		"\tgit diff         Show git config keys that \"git defaults\" would change\n" +
+		"\tgit hooks        Install shared hooks into the git template directory\n" +
+		"\tgit hooks sync   Update shared hooks in every repository under a directory\n" +
+		"\tssh              Generate SSH key, write host aliases and enable the agent\n" +
+		"\truntimes         Install pinned runtime versions and write ~/.tool-versions\n" +
+		"\truntimes drift   Compare installed runtime versions with the pins\n" +
+		"\truntimes globals Install the language tools listed in the manifest globals\n" +
+		"\tjava             List the installed JDKs\n" +
+		"\tjava install     Install the manifest JDKs (Linux) and register them with alternatives\n" +
+		"\tjava use <ver>   Set JAVA_HOME to the JDK of a major version\n" +
+		"\tenv              Write language registries and variables (Go, npm, pip, cargo, Maven)\n" +
+		"\tshell            Show the detected login shell and its rc file\n" +
+		"\tshell use <name> Make bash, zsh or fish the login shell\n" +
+		"\tshell profile    Time each block of the shell startup files and suggest what to load lazily\n" +
+		"\tzsh              Install the pinned zsh plugins and write their load order\n" +
+		"\tzsh update       Move the zsh plugin pins to the latest commit of their ref\n" +
+		"\ttheme            Write the prompt presets and pick one per terminal by the rules\n" +
+		"\ttheme list       Show the p10k and starship presets and the terminal rules\n" +
+		"\ttheme p10k       Render the p10k presets from dev4p10k with the segments, icons and style options\n" +
+		"\tfonts            Install the manifest fonts and check their digests\n" +
+		"\tfonts check      Show whether the fonts the prompt theme needs are installed\n" +
+		"\tfonts digests    Print the sha256 of each manifest font to pin it\n" +
+		"\tterminal [name]  Write the team font, colours and keys for Alacritty, Kitty, WezTerm and GNOME Terminal\n" +
+		"\taliases          Write the alias catalogue for the login shell, skipping conflicting names\n" +
+		"\taliases list     Show the aliases and functions of every category and their conflicts\n" +
+		"\tdotfiles apply   Clone or update a dotfiles repository and link its files into $HOME\n" +
+		"\tdoctor shell     Check the shell files for missing sources, repeated blocks, overwritten exports and syntax errors\n" +
+		"\tpath             Write the PATH entries of every component in one block\n" +
+		"\tpath explain     Show which component added which PATH entry\n" +
+		"\tmigrate asdf     Install every asdf runtime version again with mise\n" +
+		"\tmigrate runtimes Move nvm and pyenv versions to the runtime manager\n" +
+		"\tbackups          List the backup sets, one per run that changed files\n" +
+		"\tbackups prune    Remove all but the newest backup sets (-keep 10)\n" +
+		"\tbackups new      Start the backup set of an installer run and print its ID\n" +
+		"\tbackups snapshot Save files into the backup set before an installer changes them\n" +
+		"\trestore          Put back the files of the newest backup set (-run id, -file path)\n" +
+		"\tversion          Show dev4os version\n")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		printUsage()
+		return
+	}
+
+	switch os.Args[1] {
+	case "git":
+		gitMain(os.Args[2:])
+	case "ssh":
+		confSSH(os.Args[2:])
+	case "runtimes":
+		runtimesMain(os.Args[2:])
+	case "java":
+		javaMain(os.Args[2:])
+	case "env":
+		confLangEnv(os.Args[2:])
+	case "shell":
+		shellMain(os.Args[2:])
+	case "zsh":
+		zshMain(os.Args[2:])
+	case "theme":
+		themeMain(os.Args[2:])
+	case "fonts":
+		fontsMain(os.Args[2:])
+	case "terminal":
+		confTerminal(os.Args[2:])
+	case "aliases":
+		aliasesMain(os.Args[2:])
+	case "dotfiles":
+		dotfilesMain(os.Args[2:])
+	case "doctor":
+		doctorMain(os.Args[2:])
+	case "path":
+		pathMain(os.Args[2:])
+	case "migrate":
+		migrateMain(os.Args[2:])
+	case "backups":
+		backupsMain(os.Args[2:])
+	case "restore":
+		restoreBackup(os.Args[2:])
+	case "version", "-v", "--version":
+		fmt.Println("Dev4os version " + appVer)
+	case "help", "-h", "--help":
+		printUsage()
+	default:
+		printUsage()
+		messageError("fatal", "Unknown command \""+os.Args[1]+"\"", "Usage")
+	}
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// sourcePattern matches a file read with source or . in bash, zsh and
+	// fish, alone or after &&, ||, ;, then, do, and or or.
+	sourcePattern = regexp.MustCompile(`(?:^\s*|[;&|{]\s*|\b(?:then|do|and|or)\s+)(?:source|\.)\s+("[^"]*"|'[^']*'|[^\s;&|)]+)`)
+	// noSpacePattern matches source glued to its path, like dev4mac's
+	// "source" + homeDir() lines.
+	noSpacePattern = regexp.MustCompile(`(?:^\s*|[;&|]\s*)source["'~/$]`)
+	// gluedPattern matches a comment that swallowed the next command because
+	// of a missing newline, like "# PYENVexport PYENV_ROOT".
+	gluedPattern  = regexp.MustCompile(`^\s*#\s*[A-Z0-9_]+(export|eval|source|alias)\s+\S`)
+	exportPattern = regexp.MustCompile(`^export\s+([A-Za-z_][A-Za-z0-9_]*)=(.*)$`)
+	setxPattern   = regexp.MustCompile(`^set\s+(-[a-zA-Z]*x[a-zA-Z]*\s+)(?:-\S+\s+)*([A-Za-z_][A-Za-z0-9_]*)\s+(.*)$`)
+	repeatPattern = regexp.MustCompile(`^(?:source|\.|export|eval|alias|set)\s`)
+	syntaxLineNum = regexp.MustCompile(`:(?: line )?(\d+):`)
+	// blockCommands are the commands that write each managed block of an rc
+	// file, so a removed block can be written again.
+	blockCommands = map[string]string{
+		"aliases":             "dev4os aliases",
+		"dotfiles":            "dev4os dotfiles apply",
+		"java-home":           "dev4os java use <version>",
+		"language-env":        "dev4os env",
+		"p10k-instant-prompt": "dev4os theme",
+		"path":                "dev4os path",
+		"runtime-manager":     "dev4os runtimes",
+		"ssh-agent":           "dev4os ssh",
+		"theme":               "dev4os theme",
+		"zsh-plugins":         "dev4os zsh",
+	}
+)
+
+// blockRepair lists the managed blocks of a file that are in it more than
+// once and the ones that are broken, which repairBlocks drops.
+type blockRepair struct {
+	Repeated []string
+	Broken   []string
+}
+
+// doctorIssue is one problem found in a shell file. Block is the managed
+// block the line is in, "" for the user's lines, and Fatal tells whether the
+// shell prints an error for it.
+type doctorIssue struct {
+	Path    string
+	Num     int
+	Block   string
+	Message string
+	Text    string
+	Fatal   bool
+}
+
+// doctorFiles are the startup files of a shell, login files included, that
+// exist.
+func doctorFiles(userShell shell) []string {
+	shellFiles := startupFiles(userShell)
+	if userShell.Name() == "bash" {
+		shellFiles = []string{bashShell{}.ProfilePath(), bashShell{}.RCPath()}
+	}
+	var foundFiles []string
+	for _, shellFile := range shellFiles {
+		if checkExists(shellFile) == true {
+			foundFiles = append(foundFiles, shellFile)
+		}
+	}
+	return foundFiles
+}
+
+// expandShellPath resolves a path the way the shell would when it is only
+// made of ~, $HOME and the XDG and ZDOTDIR variables, with ${NAME:-default}
+// defaults. Anything else, such as a command substitution, a glob or a
+// variable that is not set, can't be checked and returns false.
+func expandShellPath(shellPath string) (string, bool) {
+	shellPath = strings.Trim(shellPath, "\"'")
+	if strings.ContainsAny(shellPath, "`(*?[") == true {
+		return "", false
+	}
+	if strings.HasPrefix(shellPath, "~/") {
+		shellPath = homeDir() + shellPath[2:]
+	}
+	knownDirs := map[string]string{
+		"HOME":            homeDir(),
+		"ZDOTDIR":         envDir("ZDOTDIR", homeDir()),
+		"XDG_CONFIG_HOME": envDir("XDG_CONFIG_HOME", homeDir()+".config/"),
+		"XDG_DATA_HOME":   envDir("XDG_DATA_HOME", homeDir()+".local/share/"),
+		"XDG_CACHE_HOME":  envDir("XDG_CACHE_HOME", homeDir()+".cache/"),
+	}
+	resolved := true
+	shellPath = os.Expand(shellPath, func(name string) string {
+		defaultValue := ""
+		if defaultAt := strings.Index(name, ":-"); defaultAt >= 0 {
+			name, defaultValue = name[:defaultAt], name[defaultAt+2:]
+		}
+		if knownDir, ok := knownDirs[name]; ok == true {
+			return strings.TrimSuffix(knownDir, "/")
+		} else if envValue := os.Getenv(name); envValue != "" {
+			return envValue
+		} else if defaultValue != "" {
+			defaultPath, ok := expandShellPath(defaultValue)
+			resolved = resolved && ok
+			return defaultPath
+		}
+		resolved = false
+		return ""
+	})
+	if strings.HasPrefix(shellPath, "/") != true {
+		return "", false
+	}
+	return shellPath, resolved
+}
+
+// sourceGuarded tells whether the line tests that sourceArg exists before it
+// sources it, as every dev4os block does, so a missing file does nothing.
+func sourceGuarded(rcText, sourceArg string) bool {
+	for _, testFlag := range []string{"-f ", "-r ", "-s ", "-e "} {
+		if strings.Contains(rcText, testFlag+sourceArg) == true {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSourceLines flags the files a line sources that don't exist, source
+// glued to its path and comments that swallowed a command.
+func checkSourceLines(rcPath string, lineNum int, rcText, block string) []doctorIssue {
+	var issues []doctorIssue
+	if noSpacePattern.MatchString(rcText) == true {
+		issues = append(issues, doctorIssue{rcPath, lineNum, block, "source without a space before the path", rcText, true})
+	}
+	if gluedMatch := gluedPattern.FindStringSubmatch(rcText); gluedMatch != nil {
+		issues = append(issues, doctorIssue{rcPath, lineNum, block, "comment swallowed the " + gluedMatch[1] + " after it, the newline is missing", rcText, true})
+	}
+	if strings.HasPrefix(strings.TrimSpace(rcText), "#") == true {
+		return issues
+	}
+	for _, sourceMatch := range sourcePattern.FindAllStringSubmatch(rcText, -1) {
+		sourcePath, ok := expandShellPath(sourceMatch[1])
+		if ok != true {
+			continue
+		}
+		if strings.Contains(sourcePath, "//") == true {
+			issues = append(issues, doctorIssue{rcPath, lineNum, block, "double slash in \"" + sourcePath + "\"", rcText, false})
+		}
+		if checkExists(sourcePath) == true {
+			continue
+		}
+		if sourceGuarded(rcText, sourceMatch[1]) == true {
+			issues = append(issues, doctorIssue{rcPath, lineNum, block, "\"" + sourcePath + "\" doesn't exist, the line does nothing", rcText, false})
+		} else {
+			issues = append(issues, doctorIssue{rcPath, lineNum, block, "\"" + sourcePath + "\" doesn't exist", rcText, true})
+		}
+	}
+	return issues
+}
+
+// checkSyntax runs the shell's parser over rcPath without running it, when
+// the shell is installed.
+func checkSyntax(rcPath string, rcBlocks []string) []doctorIssue {
+	checkShell := "bash"
+	if strings.HasSuffix(rcPath, ".fish") == true {
+		checkShell = "fish"
+	} else if strings.HasPrefix(filepath.Base(rcPath), ".z") == true {
+		checkShell = "zsh"
+	}
+	if _, err := exec.LookPath(checkShell); err != nil {
+		return nil
+	}
+	syntaxOut, err := exec.Command(checkShell, "-n", rcPath).CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	lineNum, block := 0, ""
+	if numMatch := syntaxLineNum.FindStringSubmatch(string(syntaxOut)); numMatch != nil {
+		lineNum, _ = strconv.Atoi(numMatch[1])
+		if lineNum > 0 && lineNum <= len(rcBlocks) {
+			block = rcBlocks[lineNum-1]
+		}
+	}
+	syntaxLines := strings.Split(strings.TrimSpace(string(syntaxOut)), "\n")
+	return []doctorIssue{{rcPath, lineNum, block, checkShell + " -n: syntax error", syntaxLines[0], true}}
+}
+
+// checkShellFiles looks through the files of a shell in the order it reads
+// them. Exports are followed across files, so one that a later file sets
+// again without using the old value is flagged.
+func checkShellFiles(shellFiles []string) ([]doctorIssue, map[string]blockRepair) {
+	var issues []doctorIssue
+	repairs := map[string]blockRepair{}
+	exportedAt := map[string]doctorIssue{}
+	seenLines := map[string]doctorIssue{}
+
+	for _, rcPath := range shellFiles {
+		rcContents := readFileContents(rcPath)
+		rcBlocks := lineBlocks(rcContents)
+		repair := blockRepair{}
+		blockCounts := map[string]int{}
+		blockSources := map[string]int{}
+		blockMissing := map[string]int{}
+
+		for lineNum, rcText := range strings.Split(strings.TrimRight(rcContents, "\n"), "\n") {
+			block := rcBlocks[lineNum]
+			if block != "" && rcText == blockBegin(block) {
+				blockCounts[block]++
+				if blockCounts[block] == 2 {
+					issues = append(issues, doctorIssue{rcPath, lineNum + 1, block, "block " + block + " is in the file more than once", rcText, false})
+					repair.Repeated = append(repair.Repeated, block)
+				}
+			}
+			if blockCounts[block] > 1 {
+				continue
+			}
+
+			issues = append(issues, checkSourceLines(rcPath, lineNum+1, rcText, block)...)
+			for _, sourceMatch := range sourcePattern.FindAllStringSubmatch(rcText, -1) {
+				if sourcePath, ok := expandShellPath(sourceMatch[1]); ok == true && block != "" && strings.HasPrefix(strings.TrimSpace(rcText), "#") != true && sourceGuarded(rcText, sourceMatch[1]) != true {
+					blockSources[block]++
+					if checkExists(sourcePath) != true {
+						blockMissing[block]++
+					}
+				}
+			}
+
+			statement := strings.TrimRight(rcText, " \t")
+			if repeatPattern.MatchString(statement) == true {
+				if firstLine, ok := seenLines[statement]; ok == true {
+					issues = append(issues, doctorIssue{rcPath, lineNum + 1, block, "repeats " + firstLine.Path + ":" + fmt.Sprint(firstLine.Num), rcText, false})
+				} else {
+					seenLines[statement] = doctorIssue{Path: rcPath, Num: lineNum + 1}
+				}
+			}
+
+			name, value := "", ""
+			if exportMatch := exportPattern.FindStringSubmatch(statement); exportMatch != nil {
+				name, value = exportMatch[1], exportMatch[2]
+			} else if setMatch := setxPattern.FindStringSubmatch(statement); setMatch != nil {
+				name, value = setMatch[2], setMatch[3]
+			}
+			if name == "" {
+				continue
+			} else if earlier, ok := exportedAt[name]; ok == true && earlier.Text != value && strings.Contains(value, "$"+name) != true && strings.Contains(value, "${"+name) != true {
+				issues = append(issues, doctorIssue{rcPath, lineNum + 1, block, name + " from " + earlier.Path + ":" + fmt.Sprint(earlier.Num) + " is overwritten", rcText, false})
+			}
+			exportedAt[name] = doctorIssue{Path: rcPath, Num: lineNum + 1, Text: value}
+		}
+
+		// A block whose every unguarded source is missing fails each time the
+		// shell starts. Guarded sources of a missing file do nothing.
+		for _, block := range sortedKeys(blockSources) {
+			if blockMissing[block] == blockSources[block] {
+				repair.Broken = append(repair.Broken, block)
+			}
+		}
+		for _, syntaxIssue := range checkSyntax(rcPath, rcBlocks) {
+			issues = append(issues, syntaxIssue)
+			if syntaxIssue.Block != "" {
+				repair.Broken = appendUnique(repair.Broken, syntaxIssue.Block)
+			}
+		}
+		if len(repair.Repeated) > 0 || len(repair.Broken) > 0 {
+			repairs[rcPath] = repair
+		}
+	}
+	return issues, repairs
+}
+
+// dropRepeatedBlocks keeps the first copy of every managed block in contents
+// and drops the later ones with the blank line before them.
+func dropRepeatedBlocks(contents string) string {
+	var keptLines []string
+	seenBlocks := map[string]bool{}
+	rcBlocks := lineBlocks(contents)
+	dropping := ""
+	for lineNum, rcText := range strings.Split(strings.TrimRight(contents, "\n"), "\n") {
+		block := rcBlocks[lineNum]
+		if block != "" && rcText == blockBegin(block) {
+			if seenBlocks[block] == true {
+				dropping = block
+				if len(keptLines) > 0 && keptLines[len(keptLines)-1] == "" {
+					keptLines = keptLines[:len(keptLines)-1]
+				}
+			}
+			seenBlocks[block] = true
+		}
+		if dropping == "" {
+			keptLines = append(keptLines, rcText)
+		} else if rcText == blockEnd(dropping) {
+			dropping = ""
+		}
+	}
+	return strings.Join(keptLines, "\n") + "\n"
+}
+
+// repairBlocks drops the repeated copies and then the broken blocks of each
+// file, keeping its permissions, and lists the commands that write the
+// dropped blocks again.
+func repairBlocks(repairs map[string]blockRepair) []string {
+	var rerunCommands []string
+	for _, rcPath := range sortedKeys(repairs) {
+		rcContents := dropRepeatedBlocks(readFileContents(rcPath))
+		for _, block := range repairs[rcPath].Repeated {
+			fmt.Println(clrRed + "  - " + clrReset + rcPath + " [" + block + "] " + clrGrey + "repeated copy" + clrReset)
+		}
+		for _, block := range repairs[rcPath].Broken {
+			rcContents = removeBlock(rcContents, block)
+			fmt.Println(clrRed + "  - " + clrReset + rcPath + " [" + block + "] " + clrGrey + "broken block" + clrReset)
+			if rerunCommand, ok := blockCommands[block]; ok == true {
+				rerunCommands = appendUnique(rerunCommands, rerunCommand)
+			}
+		}
+		rcInfo, err := os.Stat(rcPath)
+		checkError(err, "Failed to get file information of \""+rcPath+"\"")
+		makeFile(rcPath, rcContents, int(rcInfo.Mode().Perm()))
+	}
+	return rerunCommands
+}
+
+// doctorShell checks the rc and profile files of a shell and offers to
+// repair its managed blocks. The user's own lines are only reported.
+func doctorShell(args []string) {
+	doctorFlags := flag.NewFlagSet("doctor shell", flag.ExitOnError)
+	shellName := doctorFlags.String("shell", loginShell().Name(), "bash, zsh or fish")
+	assumeYes := doctorFlags.Bool("yes", false, "repair the managed blocks without asking")
+	checkError(doctorFlags.Parse(args), "Failed to parse doctor shell options")
+
+	userShell := shellByName(*shellName)
+	shellFiles := doctorFiles(userShell)
+	fmt.Println(clrCyan + "Shell files of " + userShell.Name() + clrReset)
+	if len(shellFiles) == 0 {
+		fmt.Println(lstDot + "No startup files of " + userShell.Name() + " to check.")
+		return
+	}
+
+	issues, repairs := checkShellFiles(shellFiles)
+	fatalCount := 0
+	for _, shellFile := range shellFiles {
+		fileIssues := 0
+		for _, issue := range issues {
+			if issue.Path != shellFile {
+				continue
+			}
+			fileIssues++
+			location := issue.Path + ":" + fmt.Sprint(issue.Num)
+			if issue.Block != "" {
+				location += " [" + issue.Block + "]"
+			}
+			if issue.Fatal == true {
+				fatalCount++
+				fmt.Println(clrRed + "  - " + clrReset + location + " " + issue.Message + clrGrey + "  " + strings.TrimSpace(issue.Text) + clrReset)
+			} else {
+				fmt.Println(clrYellow + "  ~ " + clrReset + location + " " + issue.Message + clrGrey + "  " + strings.TrimSpace(issue.Text) + clrReset)
+			}
+		}
+		if fileIssues == 0 {
+			fmt.Println(clrGreen + "  = " + clrReset + shellFile)
+		}
+	}
+
+	if len(repairs) > 0 {
+		if *assumeYes != true && answerYes(readInput("Repair the dev4os blocks? If you wish to continue type (Y) then press return: ")) != true {
+			fmt.Println(lstDot + "Repair cancelled.")
+		} else {
+			for _, rerunCommand := range repairBlocks(repairs) {
+				fmt.Println(lstDot + "Run \"" + rerunCommand + "\" to write its block again.")
+			}
+			issues, _ = checkShellFiles(shellFiles)
+			fatalCount = 0
+			for _, issue := range issues {
+				if issue.Fatal == true {
+					fatalCount++
+				}
+			}
+		}
+	}
+	if fatalCount > 0 {
+		messageError("fatal", fmt.Sprint(fatalCount)+" problems in the shell files need a fix by hand", "Doctor")
+	}
+	fmt.Println(lstDot + "The shell files of " + userShell.Name() + " start without errors.")
+}
+
+func doctorMain(args []string) {
+	if len(args) > 0 && args[0] == "shell" {
+		doctorShell(args[1:])
+	} else {
+		printUsage()
+		messageError("fatal", "Usage: dev4os doctor shell [-shell <bash|zsh|fish>] [-yes]", "Usage")
+	}
+}
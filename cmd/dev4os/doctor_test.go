@@ -0,0 +1,132 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpandShellPath(t *testing.T) {
+	t.Setenv("HOME", "/home/dev")
+	t.Setenv("ZDOTDIR", "")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("DEV4OS_UNSET", "")
+
+	tests := []struct {
+		shellPath string
+		want      string
+		ok        bool
+	}{
+		{"~/.bashrc", "/home/dev/.bashrc", true},
+		{"\"$HOME/.config/dev4os/aliases.sh\"", "/home/dev/.config/dev4os/aliases.sh", true},
+		{"'${ZDOTDIR}/.zshrc'", "/home/dev/.zshrc", true},
+		{"${XDG_CONFIG_HOME:-$HOME/.config}/fish/conf.d/x.fish", "/home/dev/.config/fish/conf.d/x.fish", true},
+		{"${DEV4OS_UNSET:-$HOME/.cache}/p10k.zsh", "/home/dev/.cache/p10k.zsh", true},
+		{"$HOME//.asdf/asdf.sh", "/home/dev//.asdf/asdf.sh", true},
+		{"$(brew --prefix)/etc/profile.d/z.sh", "", false},
+		{"$HOME/.zsh/*.zsh", "", false},
+		{".asdf/asdf.sh", "", false},
+	}
+	for _, test := range tests {
+		got, ok := expandShellPath(test.shellPath)
+		if ok != test.ok || (test.ok == true && got != test.want) {
+			t.Errorf("expandShellPath(%q) = %q, %v, want %q, %v", test.shellPath, got, ok, test.want, test.ok)
+		}
+	}
+	if _, ok := expandShellPath("$DEV4OS_UNSET/x.sh"); ok == true {
+		t.Error("expandShellPath resolved a variable that is not set")
+	}
+}
+
+func TestCheckSourceLines(t *testing.T) {
+	homePath := t.TempDir()
+	t.Setenv("HOME", homePath)
+	if err := os.WriteFile(homePath+"/exists.sh", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		rcText string
+		want   []string
+	}{
+		{"source \"$HOME/exists.sh\"", nil},
+		{"# source \"$HOME/missing.sh\"", nil},
+		{"source\"$HOME/exists.sh\"", []string{"fatal: source without a space before the path"}},
+		{"# PYENVexport PYENV_ROOT=\"$HOME/.pyenv\"", []string{"fatal: comment swallowed the export after it, the newline is missing"}},
+		{"source $HOME//exists.sh", []string{"warn: double slash in \"" + homePath + "//exists.sh\""}},
+		{"source \"$HOME/missing.sh\"", []string{"fatal: \"" + homePath + "/missing.sh\" doesn't exist"}},
+		{"[ -f \"$HOME/missing.sh\" ] && . \"$HOME/missing.sh\"", []string{"warn: \"" + homePath + "/missing.sh\" doesn't exist, the line does nothing"}},
+		{"test -f \"$HOME/missing.fish\"; and source \"$HOME/missing.fish\"", []string{"warn: \"" + homePath + "/missing.fish\" doesn't exist, the line does nothing"}},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, issue := range checkSourceLines(".bashrc", 1, test.rcText, "") {
+			level := "warn: "
+			if issue.Fatal == true {
+				level = "fatal: "
+			}
+			got = append(got, level+issue.Message)
+		}
+		if reflect.DeepEqual(got, test.want) != true {
+			t.Errorf("checkSourceLines(%q) = %q, want %q", test.rcText, got, test.want)
+		}
+	}
+}
+
+func TestBrokenBlocks(t *testing.T) {
+	homePath := t.TempDir()
+	t.Setenv("HOME", homePath)
+	rcPath := homePath + "/.bashrc"
+	rcContents := blockBegin("aliases") + "\n" +
+		"[ -f \"$HOME/.config/dev4os/aliases.sh\" ] && . \"$HOME/.config/dev4os/aliases.sh\"\n" +
+		blockEnd("aliases") + "\n" +
+		blockBegin("ssh-agent") + "\n" +
+		"source \"$HOME/.ssh/agent.sh\"\n" +
+		blockEnd("ssh-agent") + "\n"
+	if err := os.WriteFile(rcPath, []byte(rcContents), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The guarded aliases source does nothing while aliases.sh is missing,
+	// only the ssh-agent block fails.
+	_, repairs := checkShellFiles([]string{rcPath})
+	if got := repairs[rcPath].Broken; reflect.DeepEqual(got, []string{"ssh-agent"}) != true {
+		t.Errorf("broken blocks = %q, want [ssh-agent]", got)
+	}
+}
+
+func TestLineBlocks(t *testing.T) {
+	contents := "export EDITOR=vi\n" +
+		blockBegin("path") + "\n" +
+		"export PATH\n" +
+		blockEnd("path") + "\n" +
+		"alias ll='ls -l'\n"
+	want := []string{"", "path", "path", "path", ""}
+	if got := lineBlocks(contents); reflect.DeepEqual(got, want) != true {
+		t.Errorf("lineBlocks() = %q, want %q", got, want)
+	}
+	if got := lineBlocks("# >>> dev4os path >>>\nexport PATH\n"); reflect.DeepEqual(got, []string{"path", "path"}) != true {
+		t.Errorf("lineBlocks() of an unclosed block = %q, want it to run to the end", got)
+	}
+}
+
+func TestDropRepeatedBlocks(t *testing.T) {
+	pathBlock := blockBegin("path") + "\nexport PATH\n" + blockEnd("path") + "\n"
+	aliasBlock := blockBegin("aliases") + "\n. ~/.config/dev4os/aliases.sh\n" + blockEnd("aliases") + "\n"
+	tests := []struct {
+		name     string
+		contents string
+		want     string
+	}{
+		{"no repeats", "export EDITOR=vi\n\n" + pathBlock, "export EDITOR=vi\n\n" + pathBlock},
+		{"repeat at the end", "export EDITOR=vi\n\n" + pathBlock + "\n" + pathBlock, "export EDITOR=vi\n\n" + pathBlock},
+		{"user lines between", pathBlock + "alias ll='ls -l'\n\n" + pathBlock + "export LANG=C\n", pathBlock + "alias ll='ls -l'\nexport LANG=C\n"},
+		{"other block between", pathBlock + "\n" + aliasBlock + "\n" + pathBlock, pathBlock + "\n" + aliasBlock},
+	}
+	for _, test := range tests {
+		if got := dropRepeatedBlocks(test.contents); got != test.want {
+			t.Errorf("%s: dropRepeatedBlocks() =\n%s\nwant\n%s", test.name, strings.TrimRight(got, "\n"), strings.TrimRight(test.want, "\n"))
+		}
+	}
+}
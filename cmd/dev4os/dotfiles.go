@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bufio"
+	"dev4os/shellrc"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	dotfilesDir     = envDir("XDG_DATA_HOME", homeDir()+".local/share/") + "dev4os/dotfiles/"
+	dotfilesMapName = "dev4os.links"
+	// dotfilesSkip are the names in a dotfiles repository that never get
+	// linked into $HOME.
+	dotfilesSkip = []string{".git", ".gitmodules", ".DS_Store", dotfilesMapName}
+)
+
+// dotfilesState is the repository the last apply used and the links it
+// made, so a link the mapping no longer has can be removed.
+type dotfilesState struct {
+	Source string            `json:"source"`
+	Dir    string            `json:"dir"`
+	Links  map[string]string `json:"links"`
+}
+
+// dotfileLink is one file of the repository and the path in $HOME that
+// links to it.
+type dotfileLink struct {
+	Src string
+	Dst string
+}
+
+// fetchDotfiles returns the directory of the dotfiles. A local directory is
+// used as it is, a git URL or GitHub "user/repo" is cloned to dotfilesDir or
+// pulled when it is cloned already.
+func fetchDotfiles(source string) string {
+	if sourceInfo, err := os.Stat(source); err == nil && sourceInfo.IsDir() == true {
+		sourceDir, err := filepath.Abs(source)
+		checkError(err, "Failed to find dotfiles directory \""+source+"\"")
+		return sourceDir + "/"
+	}
+
+	repoURL := source
+	if strings.Contains(source, ":") != true && strings.Count(source, "/") == 1 {
+		repoURL = "https://github.com/" + source + ".git"
+	}
+	if checkExists(dotfilesDir) != true {
+		makeDirectory(filepath.Dir(strings.TrimSuffix(dotfilesDir, "/")))
+		gitClone := exec.Command(cmdGit, "clone", "--quiet", repoURL, dotfilesDir)
+		gitClone.Stderr = os.Stderr
+		checkError(gitClone.Run(), "Failed to clone "+repoURL)
+		return dotfilesDir
+	} else if originURL := gitRepoConfigGet(dotfilesDir, "remote.origin.url"); originURL != repoURL {
+		messageError("fatal", "\""+dotfilesDir+"\" is a clone of "+originURL+", remove it to use "+repoURL, "Dotfiles")
+	}
+	gitPull := exec.Command(cmdGit, "-C", dotfilesDir, "pull", "--quiet", "--ff-only")
+	gitPull.Stderr = os.Stderr
+	checkCmdError(gitPull.Run(), "Failed to update dotfiles, linking the current checkout of", repoURL)
+	return dotfilesDir
+}
+
+// mapTarget reads a target of the mapping file, relative to $HOME unless it
+// starts with / or ~/. Only the mapping file has this rule, paths given on the
+// command line are relative to the working directory.
+func mapTarget(target string) string {
+	if target = expandHome(target); filepath.IsAbs(target) == true {
+		return target
+	}
+	return homeDir() + target
+}
+
+// stowDir links every file under srcDir to the same path under dstDir, the
+// way stow does with --no-folding, so directories in $HOME stay real ones.
+func stowDir(srcDir, dstDir string) []dotfileLink {
+	var links []dotfileLink
+	err := filepath.WalkDir(srcDir, func(srcPath string, srcEntry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		for _, skipName := range dotfilesSkip {
+			if srcEntry.Name() == skipName && srcEntry.IsDir() == true {
+				return filepath.SkipDir
+			} else if srcEntry.Name() == skipName {
+				return nil
+			}
+		}
+		if srcEntry.IsDir() != true {
+			relPath, _ := filepath.Rel(srcDir, srcPath)
+			links = append(links, dotfileLink{srcPath, strings.TrimSuffix(dstDir, "/") + "/" + relPath})
+		}
+		return nil
+	})
+	checkError(err, "Failed to read dotfiles in \""+srcDir+"\"")
+	return links
+}
+
+// dotfileLinks reads the mapping file of repoDir. Each line is a path in the
+// repository and a path in $HOME, and a directory is linked file by file.
+// Without the mapping file every top-level directory is a stow package that
+// mirrors $HOME.
+func dotfileLinks(repoDir string) []dotfileLink {
+	var links []dotfileLink
+	if checkExists(repoDir+dotfilesMapName) != true {
+		repoEntries, err := os.ReadDir(repoDir)
+		checkError(err, "Failed to read dotfiles in \""+repoDir+"\"")
+		for _, repoEntry := range repoEntries {
+			if repoEntry.IsDir() == true && strings.HasPrefix(repoEntry.Name(), ".") != true {
+				links = append(links, stowDir(repoDir+repoEntry.Name(), homeDir())...)
+			}
+		}
+		return links
+	}
+
+	mapScan := bufio.NewScanner(strings.NewReader(readFileContents(repoDir + dotfilesMapName)))
+	for lineNum := 1; mapScan.Scan(); lineNum++ {
+		mapFields := strings.Fields(mapScan.Text())
+		if len(mapFields) == 0 || strings.HasPrefix(mapFields[0], "#") {
+			continue
+		} else if len(mapFields) != 2 {
+			messageError("fatal", dotfilesMapName+" line "+fmt.Sprint(lineNum)+" needs a repository path and a home path", "Dotfiles")
+		}
+		srcPath := repoDir + strings.TrimSuffix(mapFields[0], "/")
+		if srcInfo, err := os.Stat(srcPath); err != nil {
+			messageError("fatal", "\""+mapFields[0]+"\" in "+dotfilesMapName+" line "+fmt.Sprint(lineNum)+" is not in the repository", "Dotfiles")
+		} else if srcInfo.IsDir() == true {
+			links = append(links, stowDir(srcPath, mapTarget(mapFields[1]))...)
+		} else {
+			links = append(links, dotfileLink{srcPath, mapTarget(mapFields[1])})
+		}
+	}
+	return links
+}
+
+// managedFiles are the files dev4os writes blocks into. The dotfiles get
+// them as a .local file that the file includes instead.
+func managedFiles() []string {
+	return []string{
+		zshShell{}.RCPath(), zshShell{}.ProfilePath(),
+		bashShell{}.RCPath(), homeDir() + ".bash_profile", homeDir() + ".profile",
+		fishShell{}.RCPath(), homeDir() + ".gitconfig", gitDir + "config", sshConfigPath,
+	}
+}
+
+// includeLocal makes managedPath read its .local file, with a dotfiles block
+// for shell and ssh files and an include.path for git.
+func includeLocal(managedPath, localPath string) {
+	if managedPath == sshConfigPath {
+		writeFirstBlock(managedPath, "dotfiles", "Include "+localPath, 0600)
+	} else if managedPath == homeDir()+".gitconfig" || managedPath == gitDir+"config" {
+		includedPaths, _ := exec.Command(cmdGit, "config", "--file", managedPath, "--get-all", "include.path").Output()
+		for _, includedPath := range strings.Split(string(includedPaths), "\n") {
+			// git reads a relative include.path from the directory of the
+			// file that has it.
+			if includedPath = expandHome(includedPath); includedPath != "" && filepath.IsAbs(includedPath) != true {
+				includedPath = filepath.Join(filepath.Dir(managedPath), includedPath)
+			}
+			if includedPath == localPath {
+				return
+			}
+		}
+		snapshotFile(managedPath)
+		addInclude := exec.Command(cmdGit, "config", "--file", managedPath, "--add", "include.path", localPath)
+		checkError(addInclude.Run(), "Failed to include \""+localPath+"\" in \""+managedPath+"\"")
+	} else {
+		userShell := shell(zshShell{})
+		if managedPath == (fishShell{}).RCPath() {
+			userShell = fishShell{}
+		}
+		writeManagedBlock(managedPath, "dotfiles", renderSnippet(userShell, shellrc.Source(homeShellPath(localPath))), 0644)
+	}
+}
+
+// linkDotfile links dstPath to srcPath. A file in the way is backed up and a
+// link to somewhere else is replaced, a directory in the way is left alone.
+func linkDotfile(srcPath, dstPath string) bool {
+	dstInfo, err := os.Lstat(dstPath)
+	if err != nil {
+		makeDirectory(filepath.Dir(dstPath))
+		linkFile(srcPath, dstPath)
+		fmt.Println(clrGreen + "  + " + clrReset + dstPath)
+		return true
+	} else if oldLink, _ := os.Readlink(dstPath); oldLink == srcPath {
+		fmt.Println(clrGreen + "  = " + clrReset + dstPath)
+		return true
+	} else if dstInfo.IsDir() == true {
+		fmt.Println(clrRed + "  - " + clrReset + dstPath + clrGrey + "  is a directory, left as it is" + clrReset)
+		return false
+	} else if dstInfo.Mode()&fs.ModeSymlink != 0 {
+		fmt.Println(clrYellow + "  ~ " + clrReset + dstPath + clrGrey + "  pointed to \"" + oldLink + "\"" + clrReset)
+	} else {
+		fmt.Println(clrYellow + "  ~ " + clrReset + dstPath + clrGrey + "  backed up to \"" + snapshotFile(dstPath) + "\"" + clrReset)
+	}
+	linkFile(srcPath, dstPath)
+	return true
+}
+
+// applyDotfiles links the dotfiles into $HOME. A file dev4os keeps blocks in
+// is linked as its .local file and included from it, so the managed blocks
+// and the personal settings both load. Links of an earlier apply that the
+// mapping dropped are removed.
+func applyDotfiles(source string) {
+	oldState := dotfilesState{Links: map[string]string{}}
+	loadState("dotfiles.json", &oldState)
+	if source == "" {
+		source = oldState.Source
+	}
+	if source == "" {
+		messageError("fatal", "Usage: dev4os dotfiles apply <repo-or-path>", "Usage")
+	}
+
+	repoDir := fetchDotfiles(source)
+	fmt.Println(clrCyan + "Dotfiles" + clrReset + " from \"" + repoDir + "\"")
+	managedPaths := map[string]bool{}
+	for _, managedPath := range managedFiles() {
+		managedPaths[managedPath] = true
+	}
+
+	newState := dotfilesState{source, repoDir, map[string]string{}}
+	for _, link := range dotfileLinks(repoDir) {
+		dstPath, managedPath := link.Dst, strings.TrimSuffix(link.Dst, ".local")
+		if managedPaths[dstPath] == true {
+			dstPath += ".local"
+		}
+		if linkDotfile(link.Src, dstPath) != true {
+			continue
+		}
+		newState.Links[dstPath] = link.Src
+		if managedPaths[managedPath] == true {
+			includeLocal(managedPath, dstPath)
+			fmt.Println(clrGrey + "      included from \"" + managedPath + "\", which has dev4os blocks" + clrReset)
+		}
+	}
+
+	for _, oldPath := range sortedKeys(oldState.Links) {
+		if _, ok := newState.Links[oldPath]; ok == true {
+			continue
+		} else if oldLink, _ := os.Readlink(oldPath); oldLink == oldState.Links[oldPath] {
+			snapshotFile(oldPath)
+			checkError(os.Remove(oldPath), "Failed to remove \""+oldPath+"\"")
+			fmt.Println(clrRed + "  - " + clrReset + oldPath)
+		}
+	}
+	saveState("dotfiles.json", newState)
+	fmt.Println(lstDot + fmt.Sprint(len(newState.Links)) + " dotfiles linked, run \"dev4os dotfiles apply\" again after adding or moving files.")
+}
+
+func dotfilesMain(args []string) {
+	if len(args) > 0 && args[0] == "apply" && len(args) < 3 {
+		source := ""
+		if len(args) == 2 {
+			source = args[1]
+		}
+		applyDotfiles(source)
+	} else {
+		printUsage()
+		messageError("fatal", "Usage: dev4os dotfiles apply <repo-or-path>", "Usage")
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// fontEntry is one font file. URL has to name a commit and Sha256 is the
+// digest the download has to match, "dev4os fonts digests" prints it.
+type fontEntry struct {
+	File   string `json:"file"`
+	Family string `json:"family"`
+	URL    string `json:"url"`
+	Sha256 string `json:"sha256"`
+}
+
+// fontDir is where fonts of the current user go, which needs no sudo.
+func fontDir() string {
+	if runtime.GOOS == "darwin" {
+		return homeDir() + "Library/Fonts/"
+	}
+	return envDir("XDG_DATA_HOME", homeDir()+".local/share/") + "fonts/"
+}
+
+func fontDigest(fontData []byte) string {
+	digest := sha256.Sum256(fontData)
+	return hex.EncodeToString(digest[:])
+}
+
+// checkFontHeader tells whether fontData starts like a TrueType or OpenType
+// font, with a table directory that fits in the file. A saved error page
+// or a truncated download fails it.
+func checkFontHeader(fontData []byte) bool {
+	if len(fontData) < 12 {
+		return false
+	}
+	sfntVersion := string(fontData[:4])
+	if sfntVersion == "ttcf" {
+		return binary.BigEndian.Uint32(fontData[8:12]) > 0
+	} else if sfntVersion != "\x00\x01\x00\x00" && sfntVersion != "OTTO" && sfntVersion != "true" {
+		return false
+	}
+	numTables := int(binary.BigEndian.Uint16(fontData[4:6]))
+	return numTables > 0 && len(fontData) >= 12+numTables*16
+}
+
+// unpinnedFont names what leaves font open to a changed download: no sha256
+// in the manifest, or a URL that follows a branch instead of a commit. It is
+// empty when the font is pinned.
+func unpinnedFont(font fontEntry) string {
+	var reasons []string
+	if font.Sha256 == "" {
+		reasons = append(reasons, "has no sha256")
+	}
+	for _, branch := range []string{"/master/", "/main/", "/HEAD/"} {
+		if strings.Contains(font.URL, branch) == true {
+			reasons = append(reasons, "is downloaded from the "+strings.Trim(branch, "/")+" branch")
+		}
+	}
+	return strings.Join(reasons, " and ")
+}
+
+// requiredFonts are the fonts the applied prompt theme needs. Starship
+// modules and p10k draw Nerd Font glyphs, except p10k with ascii icons.
+func requiredFonts(teamManifest manifest) []fontEntry {
+	theme := appliedTheme(teamManifest)
+	if theme.Backend == "p10k" && theme.P10k.Icons == "ascii" {
+		return nil
+	}
+	return teamManifest.Fonts
+}
+
+// installFonts downloads every manifest font that is missing or does not
+// match its digest, then refreshes the font cache on Linux. Nothing is
+// downloaded while a font of the manifest is not pinned.
+func installFonts() {
+	teamManifest := loadManifest()
+	var unpinnedFonts []string
+	for _, font := range teamManifest.Fonts {
+		if reason := unpinnedFont(font); reason != "" {
+			unpinnedFonts = append(unpinnedFonts, font.File)
+			messageError("print", "\""+font.File+"\" "+reason+" in the manifest", "Fonts")
+		}
+	}
+	if len(unpinnedFonts) > 0 {
+		messageError("fatal", "Pin the URL of "+strings.Join(unpinnedFonts, ", ")+" to a commit and put the sha256 \"dev4os fonts digests\" prints in the manifest", "Fonts")
+	}
+
+	fmt.Println(clrCyan + "Fonts" + clrReset + " in \"" + fontDir() + "\"")
+	makeDirectory(fontDir())
+	for _, font := range teamManifest.Fonts {
+		fontPath := fontDir() + font.File
+		if oldData, err := os.ReadFile(fontPath); err == nil && fontDigest(oldData) == font.Sha256 {
+			fmt.Println(clrGreen + "  = " + clrReset + font.File)
+			continue
+		}
+
+		fontData := []byte(netHTTP(font.URL))
+		if checkFontHeader(fontData) != true {
+			messageError("fatal", "\""+font.URL+"\" is not a TrueType or OpenType font", "Fonts")
+		} else if fontDigest(fontData) != font.Sha256 {
+			messageError("fatal", "Digest of \""+font.File+"\" is "+fontDigest(fontData)+", expected "+font.Sha256, "Fonts")
+		}
+		makeFile(fontPath, string(fontData), 0644)
+		fmt.Println(clrGreen + "  + " + clrReset + font.File + " " + clrGrey + font.Sha256[:12] + clrReset)
+	}
+
+	if _, err := exec.LookPath("fc-cache"); err == nil && runtime.GOOS != "darwin" {
+		checkCmdError(exec.Command("fc-cache", "-f", fontDir()).Run(), "Failed to refresh font cache of", fontDir())
+	}
+	if len(teamManifest.Fonts) > 0 {
+		fmt.Println(lstDot + "Fonts installed, choose " + clrPurple + teamManifest.Fonts[0].Family + clrReset + " in the terminal settings.")
+	}
+}
+
+// printFontDigests downloads every manifest font and prints its sha256 for
+// the manifest, without installing it. Check the fonts before pinning them.
+func printFontDigests() {
+	fmt.Println(clrCyan + "Font digests" + clrReset)
+	for _, font := range loadManifest().Fonts {
+		fontData := []byte(netHTTP(font.URL))
+		if checkFontHeader(fontData) != true {
+			messageError("fatal", "\""+font.URL+"\" is not a TrueType or OpenType font", "Fonts")
+		}
+		fmt.Println(lstDot + font.File + "  " + fontDigest(fontData))
+		if font.Sha256 != "" && font.Sha256 != fontDigest(fontData) {
+			fmt.Println(clrYellow + "  ~ " + clrReset + "the manifest has " + font.Sha256)
+		}
+		for _, branch := range []string{"/master/", "/main/", "/HEAD/"} {
+			if strings.Contains(font.URL, branch) == true {
+				fmt.Println(clrYellow + "  ~ " + clrReset + "the URL follows the " + strings.Trim(branch, "/") + " branch, pin it to a commit before using this digest")
+			}
+		}
+	}
+}
+
+// fontFamilies lists the font families fontconfig knows, which includes the
+// fonts installed system-wide.
+func fontFamilies() map[string]bool {
+	families := map[string]bool{}
+	fcList, err := exec.Command("fc-list", ":", "family").Output()
+	if err != nil {
+		return families
+	}
+	for _, familyLine := range strings.Split(string(fcList), "\n") {
+		for _, family := range strings.Split(familyLine, ",") {
+			families[strings.TrimSpace(family)] = true
+		}
+	}
+	return families
+}
+
+// checkFonts reports whether the fonts the prompt theme needs are present,
+// in the user font directory, the system one on macOS or by family in
+// fontconfig.
+func checkFonts() {
+	teamManifest := loadManifest()
+	fonts := requiredFonts(teamManifest)
+	fmt.Println(clrCyan + "Fonts" + clrReset + " needed by the " + clrPurple + appliedTheme(teamManifest).Backend + clrReset + " theme")
+	if len(fonts) == 0 {
+		fmt.Println(lstDot + "The prompt uses ascii icons and needs no extra font.")
+		return
+	}
+
+	families := fontFamilies()
+	var missingFonts []string
+	for _, font := range fonts {
+		fontFound := false
+		for _, fontPath := range []string{fontDir() + font.File, "/Library/Fonts/" + font.File} {
+			if fontData, err := os.ReadFile(fontPath); err == nil && checkFontHeader(fontData) == true {
+				fontFound = true
+			}
+		}
+		if fontFound == true || families[font.Family] == true {
+			fmt.Println(clrGreen + "  = " + clrReset + font.File)
+		} else {
+			fmt.Println(clrRed + "  - missing  " + clrReset + font.File)
+			missingFonts = append(missingFonts, font.File)
+		}
+	}
+	if len(missingFonts) > 0 {
+		messageError("fatal", strings.Join(missingFonts, ", ")+" missing, run \"dev4os fonts\" to install", "Fonts")
+	}
+	fmt.Println(lstDot + "Every font of the prompt theme is installed.")
+}
+
+func fontsMain(args []string) {
+	if len(args) == 0 {
+		installFonts()
+	} else if args[0] == "check" {
+		checkFonts()
+	} else if args[0] == "digests" {
+		printFontDigests()
+	} else {
+		printUsage()
+		messageError("fatal", "Unknown fonts command \""+args[0]+"\"", "Usage")
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestUnpinnedFont(t *testing.T) {
+	digest := fontDigest([]byte("font"))
+	tests := []struct {
+		font fontEntry
+		want string
+	}{
+		{fontEntry{URL: "https://raw.githubusercontent.com/romkatv/dotfiles-public/0123abc/x.ttf", Sha256: digest}, ""},
+		{fontEntry{URL: "https://raw.githubusercontent.com/romkatv/dotfiles-public/0123abc/x.ttf"}, "has no sha256"},
+		{fontEntry{URL: "https://raw.githubusercontent.com/romkatv/dotfiles-public/main/x.ttf", Sha256: digest}, "is downloaded from the main branch"},
+		{fontEntry{URL: "https://raw.githubusercontent.com/romkatv/dotfiles-public/master/x.ttf"}, "has no sha256 and is downloaded from the master branch"},
+	}
+	for _, test := range tests {
+		if got := unpinnedFont(test.font); got != test.want {
+			t.Errorf("unpinnedFont(%q) = %q, want %q", test.font.URL, got, test.want)
+		}
+	}
+}
+
+func TestCheckFontHeader(t *testing.T) {
+	oneTable := append([]byte("\x00\x01\x00\x00\x00\x01\x00\x00\x00\x00\x00\x00"), make([]byte, 16)...)
+	tests := []struct {
+		name     string
+		fontData []byte
+		want     bool
+	}{
+		{"truetype", oneTable, true},
+		{"truncated table directory", oneTable[:20], false},
+		{"no tables", []byte("OTTO\x00\x00\x00\x00\x00\x00\x00\x00"), false},
+		{"error page", []byte("<!DOCTYPE html><html>404</html>"), false},
+	}
+	for _, test := range tests {
+		if got := checkFontHeader(test.fontData); got != test.want {
+			t.Errorf("%s: checkFontHeader() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
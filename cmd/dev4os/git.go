@@ -0,0 +1,45 @@
+package main
+
+import "fmt"
+
+func confG4s() {
+	fmt.Println(clrCyan + "Git global configuration" + clrReset)
+
+	fmt.Println(lstDot + "Add user information")
+	gitUserName := readInput("  - User name: ")
+	gitUserEmail := readInput("  - User email: ")
+	gitConfigSet("user.name", gitUserName)
+	gitConfigSet("user.email", gitUserEmail)
+	fmt.Println(lstDot + "Saved user name(" + gitUserName + ") and email(" + gitUserEmail + ").")
+
+	confGitDefaults()
+	confGitIgnore()
+	confGitHooks()
+
+	if answerYes(readInput(lstDot + "Sign commits and tags? If you wish to continue type (Y) then press return: ")) {
+		confSigning(nil)
+	}
+}
+
+func gitMain(args []string) {
+	if len(args) == 0 {
+		confG4s()
+		return
+	}
+
+	switch args[0] {
+	case "signing":
+		confSigning(args[1:])
+	case "ignore":
+		confGitIgnore()
+	case "defaults":
+		confGitDefaults()
+	case "diff":
+		diffGitDefaults()
+	case "hooks":
+		gitHooksMain(args[1:])
+	default:
+		printUsage()
+		messageError("fatal", "Unknown git command \""+args[0]+"\"", "Usage")
+	}
+}
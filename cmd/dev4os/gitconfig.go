@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// gitChange is one catalogue key whose value differs from ~/.gitconfig.
+type gitChange struct {
+	Group    string
+	Key      string
+	OldValue string
+	NewValue string
+	// Missing is the command the value runs when it is not installed, and
+	// such a key is left out rather than breaking git diff.
+	Missing string
+}
+
+// gitGroups returns the catalogue groups enabled by the selected profile.
+func gitGroups(teamManifest manifest) []string {
+	groups := teamManifest.selected().GitGroups
+	for _, group := range groups {
+		if _, ok := teamManifest.Git.Groups[group]; ok != true {
+			messageError("fatal", "Unknown git config group \""+group+"\" in \""+teamManifest.Profile+"\" profile", "Manifest")
+		}
+	}
+	return groups
+}
+
+// missingCommand returns the first command of a pager or diff filter value
+// that is not on PATH, as git runs those through the shell.
+func missingCommand(key, value string) string {
+	if key != "core.pager" && key != "interactive.diffFilter" && strings.HasPrefix(key, "pager.") != true {
+		return ""
+	}
+	for _, pipeCmd := range strings.Split(value, "|") {
+		if cmdFields := strings.Fields(pipeCmd); len(cmdFields) > 0 {
+			if _, err := exec.LookPath(cmdFields[0]); err != nil {
+				return cmdFields[0]
+			}
+		}
+	}
+	return ""
+}
+
+func gitChanges(teamManifest manifest) []gitChange {
+	var changes []gitChange
+	for _, group := range gitGroups(teamManifest) {
+		groupConf := teamManifest.Git.Groups[group]
+		for _, key := range sortedKeys(groupConf) {
+			if oldValue := gitConfigGet(key); oldValue != groupConf[key] {
+				changes = append(changes, gitChange{group, key, oldValue, groupConf[key], missingCommand(key, groupConf[key])})
+			}
+		}
+	}
+	return changes
+}
+
+// appliedCount is the number of changes that are not left out.
+func appliedCount(changes []gitChange) int {
+	count := 0
+	for _, change := range changes {
+		if change.Missing == "" {
+			count++
+		}
+	}
+	return count
+}
+
+func printGitChanges(changes []gitChange) {
+	group := ""
+	for _, change := range changes {
+		if change.Group != group {
+			group = change.Group
+			fmt.Println(clrPurple + "[" + group + "]" + clrReset)
+		}
+		if change.Missing != "" {
+			fmt.Println(clrGrey + "  - " + change.Key + " = " + change.NewValue + " (" + change.Missing + " is not installed, skipped)" + clrReset)
+		} else if change.OldValue == "" {
+			fmt.Println(clrGreen + "  + " + clrReset + change.Key + " = " + change.NewValue)
+		} else {
+			fmt.Println(clrYellow + "  ~ " + clrReset + change.Key + " = " + change.NewValue + clrGrey + " (was " + change.OldValue + ")" + clrReset)
+		}
+	}
+}
+
+func diffGitDefaults() {
+	teamManifest := loadManifest()
+	changes := gitChanges(teamManifest)
+
+	fmt.Println(clrCyan + "Git global configuration diff" + clrReset + " for " + clrPurple + teamManifest.Profile + clrReset + " profile")
+	if len(changes) == 0 {
+		fmt.Println(lstDot + "~/.gitconfig is up to date.")
+		return
+	}
+	printGitChanges(changes)
+	fmt.Println(lstDot + strconv.Itoa(appliedCount(changes)) + " keys would change, run \"dev4os git defaults\" to apply.")
+}
+
+func confGitDefaults() {
+	teamManifest := loadManifest()
+	changes := gitChanges(teamManifest)
+	for _, change := range changes {
+		if change.Missing == "" {
+			gitConfigSet(change.Key, change.NewValue)
+		}
+	}
+	printGitChanges(changes)
+	fmt.Println(lstDot + "Applied " + strconv.Itoa(appliedCount(changes)) + " git config keys from groups of " + clrPurple + teamManifest.Profile + clrReset + " profile.")
+}
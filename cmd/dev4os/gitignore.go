@@ -0,0 +1,130 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+var (
+	ignorePath    = gitDir + "gitignore_global"
+	ignoreEditors = []string{"vscode", "jetbrains", "vim"}
+	ignoreLangs   = map[string]string{
+		"go":     "go",
+		"node":   "node",
+		"python": "python",
+		"java":   "jvm",
+		"kotlin": "jvm",
+		"scala":  "jvm",
+		"ruby":   "ruby",
+		"rust":   "rust",
+	}
+	//go:embed templates/gitignore
+	ignoreTemplates embed.FS
+)
+
+// ignoreSection is one labelled part of the global ignore file.
+type ignoreSection struct {
+	Label   string
+	Entries []string
+}
+
+func ignoreOS() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "macos"
+	case "windows":
+		return "windows"
+	}
+	return "linux"
+}
+
+func ignoreTemplate(name string) []string {
+	rawTemplate, err := ignoreTemplates.ReadFile("templates/gitignore/" + name + ".gitignore")
+	checkError(err, "Failed to read gitignore template \""+name+"\"")
+	return strings.Split(strings.TrimRight(string(rawTemplate), "\n"), "\n")
+}
+
+// ignoreSections lists the sections for the running OS, the editors, the
+// languages of the selected profile and the team extras, in that order.
+func ignoreSections(teamManifest manifest) []ignoreSection {
+	sections := []ignoreSection{{"os/" + ignoreOS(), ignoreTemplate(ignoreOS())}}
+	for _, editor := range ignoreEditors {
+		sections = append(sections, ignoreSection{"editor/" + editor, ignoreTemplate(editor)})
+	}
+
+	addedLangs := map[string]bool{}
+	for _, lang := range teamManifest.selected().Languages {
+		langTemplate, ok := ignoreLangs[lang]
+		if ok != true || addedLangs[langTemplate] == true {
+			continue
+		}
+		addedLangs[langTemplate] = true
+		sections = append(sections, ignoreSection{"language/" + langTemplate, ignoreTemplate(langTemplate)})
+	}
+
+	if len(teamManifest.Git.Ignore) > 0 {
+		sections = append(sections, ignoreSection{"team", teamManifest.Git.Ignore})
+	}
+	return sections
+}
+
+// ignorePattern reports whether line of an ignore file is a pattern, not a
+// comment or a blank line.
+func ignorePattern(line string) bool {
+	line = strings.TrimSpace(line)
+	return line != "" && strings.HasPrefix(line, "#") != true
+}
+
+// composeIgnore renders every section as a managed block and keeps the entries
+// the user added by hand after them, dropping the patterns a section now
+// covers. Comments and blank lines of the user are kept as they are.
+func composeIgnore(sections []ignoreSection, oldContents string) string {
+	var newContents string
+	managedEntries := map[string]bool{}
+	for _, section := range sections {
+		for _, entry := range section.Entries {
+			if ignorePattern(entry) == true {
+				managedEntries[strings.TrimSpace(entry)] = true
+			}
+		}
+		newContents += renderBlock("gitignore "+section.Label, strings.Join(section.Entries, "\n")) + "\n"
+	}
+
+	var userEntries []string
+	userLines, _ := splitManaged(oldContents)
+	for _, userLine := range userLines {
+		userLine = strings.TrimRight(userLine, " \t")
+		if ignorePattern(userLine) == true && managedEntries[strings.TrimSpace(userLine)] == true {
+			continue
+		}
+		if userLine == "" && (len(userEntries) == 0 || userEntries[len(userEntries)-1] == "") {
+			continue
+		}
+		userEntries = append(userEntries, userLine)
+	}
+	if len(userEntries) > 0 && userEntries[len(userEntries)-1] == "" {
+		userEntries = userEntries[:len(userEntries)-1]
+	}
+	if len(userEntries) > 0 {
+		newContents += strings.Join(userEntries, "\n") + "\n"
+	}
+	return strings.TrimRight(newContents, "\n") + "\n"
+}
+
+func confGitIgnore() {
+	teamManifest := loadManifest()
+	sections := ignoreSections(teamManifest)
+
+	makeDirectory(gitDir)
+	makeFile(ignorePath, composeIgnore(sections, readFileContents(ignorePath)), 0644)
+	gitConfigSet("core.excludesfile", ignorePath)
+
+	var labels []string
+	for _, section := range sections {
+		labels = append(labels, section.Label)
+	}
+	fmt.Println(lstDot + "Ignore list set in \"" + ignorePath + "\" for " + clrPurple + teamManifest.Profile + clrReset + " profile.")
+	fmt.Println(lstDot + "Sections: " + strings.Join(labels, ", "))
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestComposeIgnore(t *testing.T) {
+	sections := []ignoreSection{
+		{"os/macos", []string{"# macOS", ".DS_Store", "", "._*"}},
+		{"editor/vim", []string{"# Vim", "*.swp"}},
+	}
+	managed := renderBlock("gitignore os/macos", "# macOS\n.DS_Store\n\n._*") + "\n" +
+		renderBlock("gitignore editor/vim", "# Vim\n*.swp") + "\n"
+	// Without user lines the file ends at the last block.
+	onlyManaged := strings.TrimSuffix(managed, "\n")
+	tests := []struct {
+		name        string
+		oldContents string
+		want        string
+	}{
+		{"empty file", "", onlyManaged},
+		{"only managed blocks", managed, onlyManaged},
+		{"user patterns after", managed + "build/\n*.log\n", managed + "build/\n*.log\n"},
+		{"user patterns before", "build/\n\n" + managed, managed + "build/\n"},
+		{"user lines between blocks",
+			renderBlock("gitignore os/macos", ".DS_Store") + "\n# my stuff\ntmp/\n\n" + renderBlock("gitignore editor/vim", "*.swp"),
+			managed + "# my stuff\ntmp/\n"},
+		{"duplicate patterns dropped", managed + ".DS_Store\n*.swp  \nbuild/\n", managed + "build/\n"},
+		{"comments matching a section kept", managed + "# macOS\n.env\n# Vim\n", managed + "# macOS\n.env\n# Vim\n"},
+		{"repeated blank lines folded", "\n\n# notes\n\n\n.env\n\n", managed + "# notes\n\n.env\n"},
+	}
+	for _, test := range tests {
+		if got := composeIgnore(sections, test.oldContents); got != test.want {
+			t.Errorf("%s: composeIgnore() =\n%s\nwant\n%s", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// globalsState records which globals were installed with which runtime
+// version, per language.
+type globalsState map[string]globalsInstall
+
+type globalsInstall struct {
+	Runtime  string   `json:"runtime"`
+	Packages []string `json:"packages"`
+}
+
+// corepackTools are package managers that ship with Node and only need to be
+// enabled by corepack, and prepared when a version is pinned.
+var corepackTools = map[string]bool{"pnpm": true, "yarn": true}
+
+// globalCommands returns the commands that install a package with the
+// language's own installer, in order, or nil when the language has none.
+func globalCommands(lang, pkg string) [][]string {
+	switch lang {
+	case "node":
+		toolName, toolVersion, _ := strings.Cut(pkg, "@")
+		if corepackTools[toolName] == true {
+			enableArgs := []string{"corepack", "enable", toolName}
+			if toolVersion == "" {
+				return [][]string{enableArgs}
+			}
+			return [][]string{enableArgs, {"corepack", "prepare", pkg, "--activate"}}
+		}
+		return [][]string{{"npm", "install", "--global", pkg}}
+	case "python":
+		return [][]string{{"pipx", "install", "--force", pkg}}
+	case "rust":
+		return [][]string{{"cargo", "install", "--locked", pkg}}
+	case "go":
+		if strings.Contains(pkg, "@") != true {
+			pkg += "@latest"
+		}
+		return [][]string{{"go", "install", pkg}}
+	case "ruby":
+		return [][]string{{"gem", "install", pkg}}
+	}
+	return nil
+}
+
+// pipx keeps its own virtualenvs, so the runtime version has to be passed to
+// it instead of being taken from the shims.
+func pythonCommand(manager runtimeManager, version string, installArgs []string) []string {
+	pythonBin := manager.Command("python", version, "python3", "-c", "import sys; print(sys.executable)")
+	pythonPath, err := pythonBin.Output()
+	if err != nil {
+		return installArgs
+	}
+	return append(installArgs, "--python", strings.TrimSpace(string(pythonPath)))
+}
+
+// installGlobals installs the globals of each pinned language with its default
+// version. A package is installed again only when it is new or when the
+// default version changed since the last run.
+func installGlobals(teamManifest manifest, manager runtimeManager) {
+	installed := globalsState{}
+	loadState("globals.json", &installed)
+	fmt.Println(clrCyan + "Language globals" + clrReset)
+
+	for _, pin := range pinnedRuntimes(teamManifest) {
+		packages := teamManifest.Globals[pin.Lang]
+		if len(packages) == 0 {
+			continue
+		}
+		runtimeVersion := pin.Versions[0]
+		lastInstall := installed[pin.Lang]
+		done := map[string]bool{}
+		if lastInstall.Runtime == runtimeVersion {
+			for _, pkg := range lastInstall.Packages {
+				done[pkg] = true
+			}
+		} else if lastInstall.Runtime != "" {
+			fmt.Println(lstDot + pin.Lang + " changed from " + lastInstall.Runtime + " to " + runtimeVersion + ", installing its globals again")
+		}
+
+		newInstall := globalsInstall{Runtime: runtimeVersion}
+		listed := map[string]bool{}
+		for _, pkg := range packages {
+			listed[pkg] = true
+			installCmds := globalCommands(pin.Lang, pkg)
+			if installCmds == nil {
+				messageError("print", "No global installer for "+pin.Lang+", skipped "+pkg, "Globals")
+				continue
+			} else if done[pkg] == true {
+				fmt.Println(clrGreen + "  = " + clrReset + pin.Lang + " " + pkg)
+				newInstall.Packages = append(newInstall.Packages, pkg)
+				continue
+			}
+			if pin.Lang == "python" {
+				installCmds[0] = pythonCommand(manager, runtimeVersion, installCmds[0])
+			}
+
+			fmt.Println(clrGreen + "  + " + clrReset + pin.Lang + " " + pkg)
+			var errInstall error
+			for _, installArgs := range installCmds {
+				installCmd := manager.Command(pin.Lang, runtimeVersion, installArgs...)
+				installCmd.Stderr = os.Stderr
+				if errInstall = installCmd.Run(); errInstall != nil {
+					break
+				}
+			}
+			if errInstall != nil {
+				checkCmdError(errInstall, "Failed to install "+pin.Lang+" global", pkg)
+			} else {
+				newInstall.Packages = append(newInstall.Packages, pkg)
+			}
+		}
+		for _, pkg := range lastInstall.Packages {
+			if listed[pkg] != true {
+				fmt.Println(clrYellow + "  ~ " + clrReset + pin.Lang + " " + pkg + clrGrey + " (removed from the manifest, left installed)" + clrReset)
+			}
+		}
+		installed[pin.Lang] = newInstall
+	}
+	manager.Reshim()
+
+	saveState("globals.json", installed)
+	fmt.Println(lstDot + "Installed globals recorded in \"" + stateDir + "globals.json\".")
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGlobalCommands(t *testing.T) {
+	tests := []struct {
+		lang string
+		pkg  string
+		want [][]string
+	}{
+		{"node", "typescript", [][]string{{"npm", "install", "--global", "typescript"}}},
+		{"node", "pnpm", [][]string{{"corepack", "enable", "pnpm"}}},
+		{"node", "yarn@4.1.0", [][]string{{"corepack", "enable", "yarn"}, {"corepack", "prepare", "yarn@4.1.0", "--activate"}}},
+		{"go", "golang.org/x/tools/gopls", [][]string{{"go", "install", "golang.org/x/tools/gopls@latest"}}},
+		{"go", "golang.org/x/tools/gopls@v0.15.0", [][]string{{"go", "install", "golang.org/x/tools/gopls@v0.15.0"}}},
+		{"java", "maven", nil},
+	}
+	for _, test := range tests {
+		if got := globalCommands(test.lang, test.pkg); reflect.DeepEqual(got, test.want) != true {
+			t.Errorf("globalCommands(%q, %q) = %q, want %q", test.lang, test.pkg, got, test.want)
+		}
+	}
+}
@@ -1 +1,3 @@
 module dev4os
+
+go 1.19
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"embed"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var (
+	hookTemplateDir = gitDir + "template/"
+	//go:embed templates/hooks
+	hookTemplates embed.FS
+)
+
+const hookMarker = "# dev4os-hook "
+
+// hookScript returns the hook with a marker line naming its version added
+// after the shebang, so installed copies can be compared later.
+func hookScript(hooks hookManifest, name string) string {
+	var rawScript []byte
+	var err error
+	if teamPath, ok := hooks.Files[name]; ok == true {
+		rawScript, err = os.ReadFile(expandHome(teamPath))
+		checkError(err, "Failed to read \""+name+"\" hook from \""+teamPath+"\"")
+	} else {
+		rawScript, err = hookTemplates.ReadFile("templates/hooks/" + name)
+		checkError(err, "Failed to find \""+name+"\" hook, add it to git.hooks.files in the manifest")
+	}
+
+	markerLine := hookMarker + name + " version " + strconv.Itoa(hooks.Version) + "\n"
+	shebang, body, _ := strings.Cut(string(rawScript), "\n")
+	if strings.HasPrefix(shebang, "#!") != true {
+		return "#!/bin/sh\n" + markerLine + string(rawScript)
+	}
+	return shebang + "\n" + markerLine + body
+}
+
+// hookVersion reads the marker of an installed hook. Hooks without a marker
+// were written by the user and are reported as not managed.
+func hookVersion(hookPath string) (int, bool) {
+	for _, hookLine := range strings.SplitN(readFileContents(hookPath), "\n", 3) {
+		if strings.HasPrefix(hookLine, hookMarker) {
+			markerFields := strings.Fields(hookLine)
+			version, err := strconv.Atoi(markerFields[len(markerFields)-1])
+			return version, err == nil
+		}
+	}
+	return 0, false
+}
+
+func installHook(hookPath, script string, version int, force bool) string {
+	if checkExists(hookPath) == true {
+		oldVersion, managed := hookVersion(hookPath)
+		if managed != true && force != true {
+			return "skipped, not managed by dev4os"
+		} else if managed == true && oldVersion >= version && force != true {
+			return "up to date"
+		}
+		makeFile(hookPath, script, 0755)
+		return "updated to version " + strconv.Itoa(version)
+	}
+	makeFile(hookPath, script, 0755)
+	return "installed version " + strconv.Itoa(version)
+}
+
+func installHooks(hooksDir string, hooks hookManifest, force bool) {
+	makeDirectory(hooksDir)
+	for _, name := range hooks.Enabled {
+		hookStatus := installHook(hooksDir+name, hookScript(hooks, name), hooks.Version, force)
+		fmt.Println("  - " + name + ": " + hookStatus)
+	}
+}
+
+func confGitHooks() {
+	hooks := loadManifest().Git.Hooks
+
+	fmt.Println(lstDot + "Hooks template set in \"" + hookTemplateDir + "\".")
+	installHooks(hookTemplateDir+"hooks/", hooks, true)
+	if oldTemplateDir := gitConfigGet("init.templateDir"); oldTemplateDir != "" && oldTemplateDir != hookTemplateDir {
+		fmt.Println(lstDot + "Replaced init.templateDir " + clrGrey + "(was " + oldTemplateDir + ")" + clrReset)
+	}
+	gitConfigSet("init.templateDir", hookTemplateDir)
+	fmt.Println(lstDot + "New clones and \"git init\" repositories get the hooks.")
+}
+
+// repoHooksDir returns the hooks directory of the repository checked out in
+// repoDir. A ".git" file, as worktrees and submodules have, names the real
+// git directory in its "gitdir:" line, and a worktree shares the hooks of the
+// repository in its "commondir" file.
+func repoHooksDir(repoDir string) (string, bool) {
+	dotGit := filepath.Join(repoDir, ".git")
+	dotGitInfo, err := os.Stat(dotGit)
+	if err != nil {
+		return "", false
+	} else if dotGitInfo.IsDir() == true {
+		return dotGit + "/hooks/", true
+	}
+
+	gitLine, _, _ := strings.Cut(readFileContents(dotGit), "\n")
+	if strings.HasPrefix(gitLine, "gitdir:") != true {
+		return "", false
+	}
+	repoGitDir := strings.TrimSpace(strings.TrimPrefix(gitLine, "gitdir:"))
+	if filepath.IsAbs(repoGitDir) != true {
+		repoGitDir = filepath.Join(repoDir, repoGitDir)
+	}
+	if commonDir := strings.TrimSpace(readFileContents(filepath.Join(repoGitDir, "commondir"))); commonDir != "" {
+		if filepath.IsAbs(commonDir) != true {
+			commonDir = filepath.Join(repoGitDir, commonDir)
+		}
+		repoGitDir = commonDir
+	}
+	return filepath.Clean(repoGitDir) + "/hooks/", true
+}
+
+// syncGitHooks pushes the current hooks into every repository under rootDir.
+// Repositories that point core.hooksPath somewhere else are left alone. The
+// walk doesn't go into a repository it found unless -nested is given.
+func syncGitHooks(args []string) {
+	syncFlags := flag.NewFlagSet("git hooks sync", flag.ExitOnError)
+	force := syncFlags.Bool("force", false, "overwrite hooks not managed by dev4os")
+	nested := syncFlags.Bool("nested", false, "also look for repositories inside repositories")
+	checkError(syncFlags.Parse(args), "Failed to parse git hooks sync options")
+	if syncFlags.NArg() != 1 {
+		messageError("fatal", "Usage: dev4os git hooks sync [-force] [-nested] <directory>", "Usage")
+	}
+
+	hooks := loadManifest().Git.Hooks
+	rootDir := expandHome(syncFlags.Arg(0))
+	repoCount := 0
+	syncedDirs := make(map[string]bool)
+	errWalk := filepath.WalkDir(rootDir, func(walkPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if walkPath == rootDir {
+				return err
+			}
+			fmt.Println(clrYellow + "  ~ " + clrReset + "skipped " + walkPath + clrGrey + " (" + err.Error() + ")" + clrReset)
+			return nil
+		} else if entry.IsDir() != true {
+			return nil
+		} else if entry.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		hooksDir, isRepo := repoHooksDir(walkPath)
+		if isRepo != true {
+			return nil
+		}
+		repoCount++
+		fmt.Println(lstDot + walkPath)
+		if hooksPath := gitRepoConfigGet(walkPath, "core.hooksPath"); hooksPath != "" {
+			fmt.Println("  - skipped, core.hooksPath is " + hooksPath)
+		} else if syncedDirs[hooksDir] == true {
+			fmt.Println("  - shares the hooks synced above")
+		} else {
+			syncedDirs[hooksDir] = true
+			installHooks(hooksDir, hooks, *force)
+		}
+		if *nested != true {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	checkError(errWalk, "Failed to find repositories in \""+rootDir+"\"")
+	fmt.Println(lstDot + "Synced hooks version " + strconv.Itoa(hooks.Version) + " to " + strconv.Itoa(repoCount) + " repositories.")
+}
+
+func gitHooksMain(args []string) {
+	if len(args) == 0 {
+		confGitHooks()
+	} else if args[0] == "sync" {
+		syncGitHooks(args[1:])
+	} else {
+		printUsage()
+		messageError("fatal", "Unknown git hooks command \""+args[0]+"\"", "Usage")
+	}
+}
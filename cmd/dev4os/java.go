@@ -0,0 +1,263 @@
+package main
+
+import (
+	"crypto/sha256"
+	"dev4os/shellrc"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	superUser = "sudo"
+	jvmDir    = "/usr/lib/jvm/"
+)
+
+// javaManifest lists the LTS JDKs installed system wide. Source is "distro",
+// "temurin" or "auto", which takes the distro package when the release has one
+// and the Temurin build otherwise.
+type javaManifest struct {
+	Versions []int  `json:"versions"`
+	Default  int    `json:"default"`
+	Source   string `json:"source"`
+}
+
+// jdkHome is an installed JDK found by its release file.
+type jdkHome struct {
+	Major int
+	Home  string
+}
+
+// linuxFamily returns "debian" or "rhel" from /etc/os-release.
+func linuxFamily() string {
+	osRelease := readFileContents("/etc/os-release")
+	for _, releaseLine := range strings.Split(osRelease, "\n") {
+		if strings.HasPrefix(releaseLine, "ID=") || strings.HasPrefix(releaseLine, "ID_LIKE=") {
+			releaseIDs := strings.Trim(strings.SplitN(releaseLine, "=", 2)[1], "\"")
+			for _, releaseID := range strings.Fields(releaseIDs) {
+				if releaseID == "debian" || releaseID == "ubuntu" {
+					return "debian"
+				} else if releaseID == "rhel" || releaseID == "fedora" || releaseID == "centos" {
+					return "rhel"
+				}
+			}
+		}
+	}
+	messageError("fatal", "Unsupported Linux distribution, dev4os java supports Debian and RHEL families", "OS")
+	return ""
+}
+
+// jdkPackage is the distro package name of a JDK major version.
+func jdkPackage(family string, major int) string {
+	if family == "debian" {
+		return "openjdk-" + strconv.Itoa(major) + "-jdk"
+	} else if major == 8 {
+		return "java-1.8.0-openjdk-devel"
+	}
+	return "java-" + strconv.Itoa(major) + "-openjdk-devel"
+}
+
+func jdkPackageAvailable(family, pkg string) bool {
+	if family == "debian" {
+		return exec.Command("apt-cache", "show", pkg).Run() == nil
+	}
+	return exec.Command("dnf", "info", "--quiet", pkg).Run() == nil
+}
+
+// jdkMajor reads the major version from the JAVA_VERSION line of a JDK's
+// release file, "1.8.0_402" being 8.
+func jdkMajor(jdkDir string) int {
+	for _, releaseLine := range strings.Split(readFileContents(jdkDir+"/release"), "\n") {
+		if strings.HasPrefix(releaseLine, "JAVA_VERSION=") {
+			javaVersion := strings.TrimPrefix(strings.Trim(strings.TrimPrefix(releaseLine, "JAVA_VERSION="), "\""), "1.")
+			major, _ := strconv.Atoi(strings.SplitN(strings.SplitN(javaVersion, ".", 2)[0], "_", 2)[0])
+			return major
+		}
+	}
+	return 0
+}
+
+// listJDKs finds the JDKs in /usr/lib/jvm, skipping the links distros add
+// such as default-java, and keeps one home per major version.
+func listJDKs() []jdkHome {
+	var jdkHomes []jdkHome
+	found := map[int]bool{}
+	jdkDirs, _ := os.ReadDir(jvmDir)
+	for _, jdkDir := range jdkDirs {
+		if jdkDir.IsDir() != true || checkExists(jvmDir+jdkDir.Name()+"/bin/javac") != true {
+			continue
+		}
+		if major := jdkMajor(jvmDir + jdkDir.Name()); major > 0 && found[major] != true {
+			found[major] = true
+			jdkHomes = append(jdkHomes, jdkHome{major, jvmDir + jdkDir.Name()})
+		}
+	}
+	sort.Slice(jdkHomes, func(i, j int) bool { return jdkHomes[i].Major > jdkHomes[j].Major })
+	return jdkHomes
+}
+
+func findJDK(major int) string {
+	if runtime.GOOS == "darwin" {
+		javaHome, err := exec.Command("/usr/libexec/java_home", "-v", strconv.Itoa(major)).Output()
+		if err == nil {
+			return strings.TrimSpace(string(javaHome))
+		}
+		return ""
+	}
+	for _, jdk := range listJDKs() {
+		if jdk.Major == major {
+			return jdk.Home
+		}
+	}
+	return ""
+}
+
+// downloadTemurin streams a Temurin tarball into a temporary file and checks
+// it against the .sha256.txt Adoptium publishes next to the release asset,
+// before anything is extracted.
+func downloadTemurin(temurinURL string) string {
+	resp, err := http.Get(temurinURL)
+	checkError(err, "Failed to connect "+temurinURL)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		messageError("fatal", "Failed to download from "+temurinURL, resp.Status)
+	}
+
+	tarFile, err := os.CreateTemp("", "dev4os-temurin-*.tar.gz")
+	checkError(err, "Failed to make a temporary file for Temurin")
+	tarDigest := sha256.New()
+	_, errCopy := io.Copy(io.MultiWriter(tarFile, tarDigest), resp.Body)
+	errClose := tarFile.Close()
+	if errCopy != nil || errClose != nil {
+		os.Remove(tarFile.Name())
+		messageError("fatal", "Failed to download from "+temurinURL, "Temurin")
+	}
+
+	// The API redirects to the release asset, which has the checksum file.
+	sumURL := resp.Request.URL.String() + ".sha256.txt"
+	sumFields := strings.Fields(netHTTP(sumURL))
+	if len(sumFields) == 0 || strings.EqualFold(sumFields[0], hex.EncodeToString(tarDigest.Sum(nil))) != true {
+		os.Remove(tarFile.Name())
+		messageError("fatal", "Temurin download does not match the checksum in "+sumURL, "Checksum")
+	}
+	return tarFile.Name()
+}
+
+// installTemurin unpacks the latest Temurin build of a major version into
+// /usr/lib/jvm/temurin-<major>.
+func installTemurin(major int) string {
+	jdkArch := "x64"
+	if runtime.GOARCH == "arm64" {
+		jdkArch = "aarch64"
+	}
+	temurinURL := "https://api.adoptium.net/v3/binary/latest/" + strconv.Itoa(major) + "/ga/linux/" + jdkArch + "/jdk/hotspot/normal/eclipse"
+	tarPath := downloadTemurin(temurinURL)
+	defer os.Remove(tarPath)
+
+	jdkDir := jvmDir + "temurin-" + strconv.Itoa(major)
+	makeJDKDir := exec.Command(superUser, "mkdir", "-p", jdkDir)
+	checkError(makeJDKDir.Run(), "Failed to make \""+jdkDir+"\"")
+	untarJDK := exec.Command(superUser, "tar", "-xzf", tarPath, "-C", jdkDir, "--strip-components=1")
+	untarJDK.Stderr = os.Stderr
+	checkError(untarJDK.Run(), "Failed to extract Temurin "+strconv.Itoa(major))
+	return jdkDir
+}
+
+// registerJDK adds java and javac of a JDK to update-alternatives, with the
+// major version as priority so the newest JDK wins in auto mode.
+func registerJDK(family, jdkDir string, major int) {
+	cmdAlternatives := "update-alternatives"
+	if family == "rhel" {
+		cmdAlternatives = "alternatives"
+	}
+	for _, jdkTool := range []string{"java", "javac"} {
+		addAlternative := exec.Command(superUser, cmdAlternatives, "--install", "/usr/bin/"+jdkTool, jdkTool, jdkDir+"/bin/"+jdkTool, strconv.Itoa(major*100))
+		checkCmdError(addAlternative.Run(), "Failed to register alternative", jdkTool+" "+strconv.Itoa(major))
+	}
+}
+
+func installJDKs() {
+	if runtime.GOOS != "linux" {
+		messageError("fatal", "dev4os java install is for Linux, on macOS the JDKs come with dev4mac", "OS")
+	}
+	javaConf := loadManifest().Java
+	family := linuxFamily()
+	fmt.Println(clrCyan + "JDK" + clrReset + " from " + clrPurple + javaConf.Source + clrReset + " sources")
+
+	for _, major := range javaConf.Versions {
+		if jdkDir := findJDK(major); jdkDir != "" {
+			fmt.Println(clrGreen + "  = " + clrReset + "JDK " + strconv.Itoa(major) + clrGrey + " (" + jdkDir + ")" + clrReset)
+			continue
+		}
+
+		pkg := jdkPackage(family, major)
+		if javaConf.Source == "distro" || (javaConf.Source != "temurin" && jdkPackageAvailable(family, pkg) == true) {
+			fmt.Println(clrGreen + "  + " + clrReset + "JDK " + strconv.Itoa(major) + clrGrey + " (" + pkg + ")" + clrReset)
+			cmdPMS := "apt-get"
+			if family == "rhel" {
+				cmdPMS = "dnf"
+			}
+			pmsIns := exec.Command(superUser, cmdPMS, "install", "-y", pkg)
+			pmsIns.Stderr = os.Stderr
+			checkCmdError(pmsIns.Run(), "Failed to install", pkg)
+		} else {
+			fmt.Println(clrGreen + "  + " + clrReset + "JDK " + strconv.Itoa(major) + clrGrey + " (Temurin)" + clrReset)
+			registerJDK(family, installTemurin(major), major)
+		}
+	}
+
+	if javaConf.Default > 0 {
+		useJDK([]string{strconv.Itoa(javaConf.Default)})
+	}
+}
+
+func listInstalledJDKs() {
+	javaHome := os.Getenv("JAVA_HOME")
+	for _, jdk := range listJDKs() {
+		if jdk.Home == javaHome {
+			fmt.Println(clrGreen + " * " + clrReset + strconv.Itoa(jdk.Major) + "\t" + jdk.Home)
+		} else {
+			fmt.Println("   " + strconv.Itoa(jdk.Major) + "\t" + jdk.Home)
+		}
+	}
+}
+
+// useJDK sets JAVA_HOME for new shells. The system java from alternatives is
+// left alone, so other users keep their choice.
+func useJDK(args []string) {
+	if len(args) != 1 {
+		messageError("fatal", "Usage: dev4os java use <major version>", "Usage")
+	}
+	major, err := strconv.Atoi(strings.TrimPrefix(args[0], "1."))
+	checkError(err, "Invalid JDK version \""+args[0]+"\"")
+
+	jdkDir := findJDK(major)
+	if jdkDir == "" {
+		messageError("fatal", "JDK "+args[0]+" is not installed, run \"dev4os java install\"", "JDK")
+	}
+	userShell := loginShell()
+	rcPath := userShell.RCPath()
+	writeManagedBlock(rcPath, "java-home", renderSnippet(userShell, shellrc.Export("JAVA_HOME", jdkDir)), 0644)
+	writePath(loadManifest())
+	fmt.Println(lstDot + "JAVA_HOME set to \"" + jdkDir + "\" in \"" + rcPath + "\", open a new shell to use it.")
+}
+
+func javaMain(args []string) {
+	if len(args) == 0 || args[0] == "list" {
+		listInstalledJDKs()
+	} else if args[0] == "install" {
+		installJDKs()
+	} else if args[0] == "use" {
+		useJDK(args[1:])
+	} else {
+		printUsage()
+		messageError("fatal", "Unknown java command \""+args[0]+"\"", "Usage")
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"dev4os/shellrc"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	npmrcPath         = homeDir() + ".npmrc"
+	mavenSettingsPath = homeDir() + ".m2/settings.xml"
+	mavenManagedLine  = "<!-- Managed by dev4os, regenerated by \"dev4os env\". -->"
+	// langBinDirs are the variables whose bin directory has to be on PATH for
+	// the tools installed there to run.
+	langBinDirs = []string{"GOPATH", "CARGO_HOME"}
+)
+
+// langEnvManifest holds the per-language settings that point tools at the
+// team's registries. Vars are exported in the rc file for the languages of the
+// selected profile, and empty values are left unset. A language named in the
+// team manifest replaces the default vars of that language.
+type langEnvManifest struct {
+	Vars  map[string]map[string]string `json:"vars"`
+	Npm   npmManifest                  `json:"npm"`
+	Pip   pipManifest                  `json:"pip"`
+	Maven mavenManifest                `json:"maven"`
+}
+
+// npmManifest is written to ~/.npmrc. Scopes maps a scope such as "@acme" to
+// its registry.
+type npmManifest struct {
+	Prefix   string            `json:"prefix"`
+	Registry string            `json:"registry"`
+	Scopes   map[string]string `json:"scopes"`
+}
+
+type pipManifest struct {
+	IndexURL      string `json:"indexUrl"`
+	ExtraIndexURL string `json:"extraIndexUrl"`
+	TrustedHost   string `json:"trustedHost"`
+}
+
+type mavenManifest struct {
+	Mirrors []mavenMirror `json:"mirrors"`
+}
+
+type mavenMirror struct {
+	ID       string `json:"id" xml:"id"`
+	Name     string `json:"name" xml:"name,omitempty"`
+	URL      string `json:"url" xml:"url"`
+	MirrorOf string `json:"mirrorOf" xml:"mirrorOf"`
+}
+
+// homeValue writes a leading "~/" as $HOME, which every shell expands inside
+// quotes, so the file stays valid for another user.
+func homeValue(value string) string {
+	if strings.HasPrefix(value, "~/") {
+		return "$HOME/" + value[2:]
+	}
+	return value
+}
+
+// langEnvVars collects the variables of the selected languages, pip settings
+// included.
+func langEnvVars(teamManifest manifest) map[string]string {
+	envVars := map[string]string{}
+	for _, lang := range teamManifest.selected().Languages {
+		for envName, envValue := range teamManifest.Env.Vars[lang] {
+			if envValue != "" {
+				envVars[envName] = envValue
+			}
+		}
+		if lang == "python" {
+			pipVars := map[string]string{
+				"PIP_INDEX_URL":       teamManifest.Env.Pip.IndexURL,
+				"PIP_EXTRA_INDEX_URL": teamManifest.Env.Pip.ExtraIndexURL,
+				"PIP_TRUSTED_HOST":    teamManifest.Env.Pip.TrustedHost,
+			}
+			for envName, envValue := range pipVars {
+				if envValue != "" {
+					envVars[envName] = envValue
+				}
+			}
+		}
+	}
+	return envVars
+}
+
+func renderLangEnv(userShell shell, envVars map[string]string) string {
+	var envLines []shellrc.Line
+	for _, envName := range sortedKeys(envVars) {
+		envLines = append(envLines, shellrc.Export(envName, homeValue(envVars[envName])))
+	}
+	return renderSnippet(userShell, envLines...)
+}
+
+// langEnvPaths are the bin directories of GOPATH, CARGO_HOME and the npm
+// prefix, for the path block.
+func langEnvPaths(teamManifest manifest) []pathEntry {
+	var entries []pathEntry
+	envVars := langEnvVars(teamManifest)
+	for _, binVar := range langBinDirs {
+		if envVars[binVar] != "" {
+			entries = append(entries, pathEntry{"language-env", "$" + binVar + "/bin", 70})
+		}
+	}
+	for _, lang := range teamManifest.selected().Languages {
+		if lang == "node" && teamManifest.Env.Npm.Prefix != "" {
+			entries = append(entries, pathEntry{"language-env", homeValue(teamManifest.Env.Npm.Prefix) + "/bin", 70})
+		}
+	}
+	return entries
+}
+
+func renderNpmrc(npm npmManifest) string {
+	var npmLines []string
+	if npm.Prefix != "" {
+		npmLines = append(npmLines, "prefix="+expandHome(npm.Prefix))
+	}
+	if npm.Registry != "" {
+		npmLines = append(npmLines, "registry="+npm.Registry)
+	}
+	for _, scope := range sortedKeys(npm.Scopes) {
+		npmLines = append(npmLines, "@"+strings.TrimPrefix(scope, "@")+":registry="+npm.Scopes[scope])
+	}
+	return strings.Join(npmLines, "\n")
+}
+
+func renderMavenSettings(maven mavenManifest) string {
+	mavenSettings := struct {
+		XMLName xml.Name      `xml:"settings"`
+		XMLNS   string        `xml:"xmlns,attr"`
+		Mirrors []mavenMirror `xml:"mirrors>mirror"`
+	}{XMLNS: "http://maven.apache.org/SETTINGS/1.2.0", Mirrors: maven.Mirrors}
+	settingsXML, err := xml.MarshalIndent(mavenSettings, "", "  ")
+	checkError(err, "Failed to encode Maven settings")
+	return xml.Header + mavenManagedLine + "\n" + string(settingsXML) + "\n"
+}
+
+// confMaven writes settings.xml as a whole file, since an XML file has no
+// place for a managed block. A settings.xml dev4os did not write is kept
+// unless force is set.
+func confMaven(maven mavenManifest, force bool) {
+	if len(maven.Mirrors) == 0 {
+		return
+	}
+	if strings.Contains(readFileContents(mavenSettingsPath), mavenManagedLine) != true && checkExists(mavenSettingsPath) == true && force != true {
+		fmt.Println(clrYellow + "  ~ " + clrReset + "\"" + mavenSettingsPath + "\" is not managed by dev4os, run \"dev4os env -force\" to replace it")
+		return
+	}
+	makeDirectory(homeDir() + ".m2")
+	makeFile(mavenSettingsPath, renderMavenSettings(maven), 0644)
+	fmt.Println(lstDot + "Maven mirrors set in \"" + mavenSettingsPath + "\".")
+}
+
+// applyLangEnv writes the settings and exports the variables to this process
+// too, so the installs that follow already use the team registries.
+func applyLangEnv(teamManifest manifest, force bool) {
+	fmt.Println(clrCyan + "Language environment" + clrReset)
+	selectedLangs := map[string]bool{}
+	for _, lang := range teamManifest.selected().Languages {
+		selectedLangs[lang] = true
+	}
+
+	envVars := langEnvVars(teamManifest)
+	for envName, envValue := range envVars {
+		checkError(os.Setenv(envName, expandHome(envValue)), "Failed to set \""+envName+"\"")
+	}
+	userShell := loginShell()
+	rcPath := userShell.RCPath()
+	writeManagedBlock(rcPath, "language-env", renderLangEnv(userShell, envVars), 0644)
+	writePath(teamManifest)
+	fmt.Println(lstDot + fmt.Sprint(len(envVars)) + " variables set in \"" + rcPath + "\".")
+
+	if npmrc := renderNpmrc(teamManifest.Env.Npm); selectedLangs["node"] == true && npmrc != "" {
+		writeManagedBlock(npmrcPath, "npm", npmrc, 0600)
+		fmt.Println(lstDot + "npm registry set in \"" + npmrcPath + "\".")
+	}
+	if selectedLangs["java"] == true {
+		confMaven(teamManifest.Env.Maven, force)
+	}
+}
+
+func confLangEnv(args []string) {
+	envFlags := flag.NewFlagSet("env", flag.ExitOnError)
+	force := envFlags.Bool("force", false, "replace a Maven settings.xml not managed by dev4os")
+	checkError(envFlags.Parse(args), "Failed to parse env options")
+	applyLangEnv(loadManifest(), *force)
+}
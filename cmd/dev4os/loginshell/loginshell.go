@@ -0,0 +1,124 @@
+// Package loginshell reads and changes the login shell of a user. dev4os and
+// the dev4deb, dev4rpm and dev4mac installers share it, so they agree on which
+// shell a user has and change it the same way.
+package loginshell
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Supported are the shells dev4os and the installers write rc files for.
+var Supported = []string{"bash", "zsh", "fish"}
+
+func supported(name string) bool {
+	for _, shellName := range Supported {
+		if name == shellName {
+			return true
+		}
+	}
+	return false
+}
+
+// Passwd reads the login shell of userName from the user database, dscl on
+// macOS and getent elsewhere, which is right even when $SHELL is stale after
+// chsh. It is empty when the database has no entry.
+func Passwd(userName string) string {
+	if runtime.GOOS == "darwin" {
+		readShell, err := exec.Command("dscl", ".", "-read", "/Users/"+userName, "UserShell").Output()
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(string(readShell)), "UserShell:"))
+	}
+	passwdEntry, err := exec.Command("getent", "passwd", userName).Output()
+	if err != nil {
+		return ""
+	}
+	passwdFields := strings.Split(strings.TrimSpace(string(passwdEntry)), ":")
+	return passwdFields[len(passwdFields)-1]
+}
+
+// Detect names the shell to set up for userName: $DEV4OS_SHELL, the login
+// shell of the user database or $SHELL, the first of them that is supported.
+// It is empty when none is.
+func Detect(userName string) string {
+	for _, shellName := range []string{os.Getenv("DEV4OS_SHELL"), filepath.Base(Passwd(userName)), filepath.Base(os.Getenv("SHELL"))} {
+		if supported(shellName) == true {
+			return shellName
+		}
+	}
+	return ""
+}
+
+// Listed returns the /etc/shells entry of shellPath, which chsh requires for
+// any shell a user picks. An entry such as /bin/zsh that is the same file as
+// /usr/bin/zsh counts, and an empty string means there is none.
+func Listed(shellPath string) string {
+	shellInfo, err := os.Stat(shellPath)
+	if err != nil {
+		return ""
+	}
+	etcShells, _ := os.ReadFile("/etc/shells")
+	for _, shellLine := range strings.Split(string(etcShells), "\n") {
+		listedPath := strings.TrimSpace(shellLine)
+		if listedPath == shellPath {
+			return listedPath
+		} else if listedInfo, err := os.Stat(listedPath); err == nil && strings.HasPrefix(listedPath, "/") && os.SameFile(shellInfo, listedInfo) {
+			return listedPath
+		}
+	}
+	return ""
+}
+
+func stdinInteractive() bool {
+	stdinInfo, err := os.Stdin.Stat()
+	return err == nil && stdinInfo.Mode()&os.ModeCharDevice != 0
+}
+
+// Change makes name the login shell of userName and returns its path. The
+// shell is found with command -v and added to /etc/shells when it is not
+// listed there. chsh asks for the user's password, so root and
+// non-interactive runs use usermod, or chsh through superUser on macOS where
+// there is no usermod. The user database is read back to check the change.
+func Change(name, userName, superUser string) (string, error) {
+	shellPath, err := exec.LookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("can't find %s, install it first: %w", name, err)
+	}
+	if listedPath := Listed(shellPath); listedPath != "" {
+		shellPath = listedPath
+	} else {
+		addShell := exec.Command(superUser, "tee", "-a", "/etc/shells")
+		addShell.Stdin = strings.NewReader(shellPath + "\n")
+		if err := addShell.Run(); err != nil {
+			return shellPath, fmt.Errorf("failed to add %q to /etc/shells: %w", shellPath, err)
+		}
+	}
+
+	var changeShell *exec.Cmd
+	if stdinInteractive() == true && os.Geteuid() != 0 {
+		changeShell = exec.Command("chsh", "-s", shellPath)
+		changeShell.Stdin = os.Stdin
+		changeShell.Stdout = os.Stdout
+	} else if runtime.GOOS == "darwin" {
+		changeShell = exec.Command(superUser, "chsh", "-s", shellPath, userName)
+	} else if os.Geteuid() == 0 {
+		changeShell = exec.Command("usermod", "-s", shellPath, userName)
+	} else {
+		changeShell = exec.Command(superUser, "usermod", "-s", shellPath, userName)
+	}
+	changeShell.Stderr = os.Stderr
+	if err := changeShell.Run(); err != nil {
+		return shellPath, fmt.Errorf("failed to change login shell to %q: %w", shellPath, err)
+	}
+
+	if passwdShell := Passwd(userName); passwdShell != shellPath {
+		return shellPath, fmt.Errorf("login shell is still %q in the user database", passwdShell)
+	}
+	return shellPath, nil
+}
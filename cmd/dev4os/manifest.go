@@ -0,0 +1,115 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"os"
+	"sort"
+)
+
+var (
+	confDir      = homeDir() + ".config/dev4os/"
+	manifestPath = confDir + "manifest.json"
+	//go:embed manifest.json
+	defaultManifest []byte
+)
+
+// manifest is the team configuration. The embedded manifest.json holds the
+// defaults and the team file only has to name what it changes.
+type manifest struct {
+	Profile  string                   `json:"profile"`
+	Profiles map[string]profileConfig `json:"profiles"`
+	Git      gitManifest              `json:"git"`
+	SSH      sshManifest              `json:"ssh"`
+	Runtimes map[string][]string      `json:"runtimes"` // versions per language, the first is the default
+	Manager  string                   `json:"runtimeManager"`
+	Globals  map[string][]string      `json:"globals"` // tools installed with each language's own installer
+	Env      langEnvManifest          `json:"env"`
+	Java     javaManifest             `json:"java"`
+	Path     []pathEntry              `json:"path"` // team directories added to PATH
+	Zsh      zshManifest              `json:"zsh"`
+	Theme    themeManifest            `json:"theme"`
+	Fonts    []fontEntry              `json:"fonts"`
+	Terminal terminalManifest         `json:"terminal"`
+	Aliases  map[string]aliasGroup    `json:"aliases"` // alias catalogue by category
+}
+
+type profileConfig struct {
+	Languages []string `json:"languages"`
+	GitGroups []string `json:"gitGroups"`
+}
+
+// gitManifest holds the team ignore entries and the git config catalogue. A
+// group named in the team manifest replaces the default group of that name.
+type gitManifest struct {
+	Ignore []string                     `json:"ignore"`
+	Groups map[string]map[string]string `json:"groups"`
+	Hooks  hookManifest                 `json:"hooks"`
+}
+
+// hookManifest lists the shared hooks. Files maps a hook name to a script the
+// team ships instead of the embedded one, and Version is bumped whenever any
+// hook changes so "git hooks sync" knows which repositories are behind.
+type hookManifest struct {
+	Version int               `json:"version"`
+	Enabled []string          `json:"enabled"`
+	Files   map[string]string `json:"files"`
+}
+
+type sshManifest struct {
+	Key   string    `json:"key"`
+	Hosts []sshHost `json:"hosts"`
+}
+
+// sshHost is one host alias written to ~/.ssh/config. Options holds any other
+// ssh_config keyword, such as ForwardAgent or ServerAliveInterval.
+type sshHost struct {
+	Host         string            `json:"host"`
+	HostName     string            `json:"hostName"`
+	User         string            `json:"user"`
+	Port         int               `json:"port"`
+	ProxyJump    string            `json:"proxyJump"`
+	IdentityFile string            `json:"identityFile"`
+	Options      map[string]string `json:"options"`
+}
+
+// loadManifest reads the embedded defaults, then the team manifest from
+// $DEV4OS_MANIFEST or ~/.config/dev4os/manifest.json on top of them.
+// $DEV4OS_PROFILE overrides the selected profile.
+func loadManifest() manifest {
+	var teamManifest manifest
+	errDefault := json.Unmarshal(defaultManifest, &teamManifest)
+	checkError(errDefault, "Failed to parse embedded manifest")
+
+	teamPath := manifestPath
+	if envPath := os.Getenv("DEV4OS_MANIFEST"); envPath != "" {
+		teamPath = envPath
+	}
+	if checkExists(teamPath) == true {
+		teamFile, err := os.ReadFile(teamPath)
+		checkError(err, "Failed to read manifest \""+teamPath+"\"")
+		errTeam := json.Unmarshal(teamFile, &teamManifest)
+		checkError(errTeam, "Failed to parse manifest \""+teamPath+"\"")
+	}
+
+	if envProfile := os.Getenv("DEV4OS_PROFILE"); envProfile != "" {
+		teamManifest.Profile = envProfile
+	}
+	if _, ok := teamManifest.Profiles[teamManifest.Profile]; ok != true {
+		messageError("fatal", "Unknown profile \""+teamManifest.Profile+"\"", "Manifest")
+	}
+	return teamManifest
+}
+
+func (m manifest) selected() profileConfig {
+	return m.Profiles[m.Profile]
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	nvmDir   = envDir("NVM_DIR", homeDir()+".nvm/")
+	pyenvDir = envDir("PYENV_ROOT", homeDir()+".pyenv/")
+	rcFiles  = []string{".zshrc", ".zprofile", ".bashrc", ".bash_profile", ".profile"}
+	// oldInitSections are the headers of the nvm and pyenv blocks the
+	// installers append, including dev4mac's "# PYENVexport PYENV_ROOT" that
+	// lost its newline.
+	oldInitSections = []string{"# NVM", "# PYENV"}
+	// oldInitLines match nvm and pyenv init anywhere else in the rc files,
+	// which is only reported.
+	oldInitLines = []string{"NVM_DIR", "nvm.sh", "bash_completion.d/nvm", "PYENV_ROOT", "pyenv init", "pyenv virtualenv-init"}
+)
+
+// runtimeInstall is one version found under an old version manager.
+type runtimeInstall struct {
+	From    string
+	Lang    string
+	Version string
+}
+
+// rcLine is one line of an rc file that a migration removes or reports.
+type rcLine struct {
+	Path string
+	Num  int
+	Text string
+}
+
+type migratePlan struct {
+	Installs  []runtimeInstall
+	Defaults  map[string]string
+	RCLines   []rcLine
+	KeptLines []rcLine
+}
+
+// compareVersions orders dotted versions numerically, so 3.10.1 > 3.9.18.
+func compareVersions(verA, verB string) int {
+	partsA, partsB := strings.Split(verA, "."), strings.Split(verB, ".")
+	for partNum := 0; partNum < len(partsA) && partNum < len(partsB); partNum++ {
+		numA, errA := strconv.Atoi(partsA[partNum])
+		numB, errB := strconv.Atoi(partsB[partNum])
+		if errA != nil || errB != nil {
+			if cmp := strings.Compare(partsA[partNum], partsB[partNum]); cmp != 0 {
+				return cmp
+			}
+		} else if numA != numB {
+			if numA < numB {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(partsA) - len(partsB)
+}
+
+// matchVersion returns the highest installed version that is prefix or equal
+// to the alias, the same way nvm resolves "20" to the newest 20.x.
+func matchVersion(alias string, versions []string) string {
+	found := ""
+	for _, version := range versions {
+		if version == alias || strings.HasPrefix(version, alias+".") {
+			if found == "" || compareVersions(version, found) > 0 {
+				found = version
+			}
+		}
+	}
+	return found
+}
+
+func nvmVersions() []string {
+	var versions []string
+	for _, version := range listVersionDirs(nvmDir + "versions/node") {
+		versions = append(versions, strings.TrimPrefix(version, "v"))
+	}
+	return versions
+}
+
+// nvmDefault follows the default alias through named aliases such as
+// lts/iron until it reaches a version.
+func nvmDefault(versions []string) string {
+	alias := "default"
+	for aliasDepth := 0; aliasDepth < 5; aliasDepth++ {
+		aliasFile := readFileContents(nvmDir + "alias/" + alias)
+		if aliasFile == "" {
+			break
+		}
+		alias = strings.TrimPrefix(strings.TrimSpace(aliasFile), "v")
+	}
+	if alias == "node" || alias == "stable" || alias == "default" {
+		alias = ""
+		for _, version := range versions {
+			if alias == "" || compareVersions(version, alias) > 0 {
+				alias = version
+			}
+		}
+		return alias
+	}
+	return matchVersion(alias, versions)
+}
+
+// pyenvVersions skips virtualenvs and builds such as miniconda or pypy that a
+// runtime manager would name differently.
+func pyenvVersions() []string {
+	var versions []string
+	for _, version := range listVersionDirs(pyenvDir + "versions") {
+		if _, err := strconv.Atoi(strings.Split(version, ".")[0]); err == nil {
+			versions = append(versions, version)
+		}
+	}
+	return versions
+}
+
+func pyenvDefault(versions []string) string {
+	for _, version := range strings.Fields(readFileContents(pyenvDir + "version")) {
+		if found := matchVersion(version, versions); found != "" {
+			return found
+		}
+	}
+	return ""
+}
+
+// findRCLines lists the lines of the rc files that contain any of patterns,
+// leaving out the lines of skip.
+func findRCLines(patterns []string, skip []rcLine) []rcLine {
+	var found []rcLine
+	skipLines := map[rcLine]bool{}
+	for _, skipLine := range skip {
+		skipLines[skipLine] = true
+	}
+	for _, rcFile := range rcFiles {
+		rcPath := homeDir() + rcFile
+		for lineNum, rcText := range strings.Split(readFileContents(rcPath), "\n") {
+			for _, pattern := range patterns {
+				if strings.Contains(rcText, pattern) && skipLines[rcLine{rcPath, lineNum + 1, rcText}] != true {
+					found = append(found, rcLine{rcPath, lineNum + 1, rcText})
+					break
+				}
+			}
+		}
+	}
+	return found
+}
+
+// findRCSections lists every line of the blocks dev4mac, dev4deb and dev4rpm
+// appended to the rc files under one of headers. A block starts at its
+// "# NAME" header and runs to the next blank line, which goes with it, or to
+// the next header. Lines of the user and of dev4os blocks are never part of
+// one, so removing a block can't leave half of an if or a function behind.
+func findRCSections(headers []string) []rcLine {
+	var found []rcLine
+	for _, rcFile := range rcFiles {
+		rcPath := homeDir() + rcFile
+		rcContents := readFileContents(rcPath)
+		rcBlocks := lineBlocks(rcContents)
+		inSection := false
+		for lineNum, rcText := range strings.Split(strings.TrimRight(rcContents, "\n"), "\n") {
+			if inSection == true && rcText == "" {
+				found = append(found, rcLine{rcPath, lineNum + 1, rcText})
+				inSection = false
+				continue
+			} else if inSection == true && strings.HasPrefix(rcText, "# ") != true {
+				found = append(found, rcLine{rcPath, lineNum + 1, rcText})
+				continue
+			}
+			inSection = false
+			for _, header := range headers {
+				if rcBlocks[lineNum] == "" && strings.HasPrefix(rcText, header) {
+					found = append(found, rcLine{rcPath, lineNum + 1, rcText})
+					inSection = true
+					break
+				}
+			}
+		}
+	}
+	return found
+}
+
+func planRuntimeMigration(manager runtimeManager) migratePlan {
+	plan := migratePlan{Defaults: map[string]string{}}
+	oldManagers := []struct {
+		From     string
+		Lang     string
+		Versions []string
+		Default  func([]string) string
+	}{
+		{"nvm", "node", nvmVersions(), nvmDefault},
+		{"pyenv", "python", pyenvVersions(), pyenvDefault},
+	}
+
+	for _, oldManager := range oldManagers {
+		installed := map[string]bool{}
+		for _, version := range manager.Installed(oldManager.Lang) {
+			installed[version] = true
+		}
+		for _, version := range oldManager.Versions {
+			if installed[version] != true {
+				plan.Installs = append(plan.Installs, runtimeInstall{oldManager.From, oldManager.Lang, version})
+			}
+		}
+		if defaultVersion := oldManager.Default(oldManager.Versions); defaultVersion != "" {
+			plan.Defaults[oldManager.Lang] = defaultVersion
+		}
+	}
+	plan.RCLines = findRCSections(oldInitSections)
+	plan.KeptLines = findRCLines(oldInitLines, plan.RCLines)
+	return plan
+}
+
+func printMigratePlan(plan migratePlan, manager runtimeManager, pinned map[string]bool) {
+	fmt.Println(lstDot + "Install with " + clrPurple + manager.Name() + clrReset)
+	for _, install := range plan.Installs {
+		fmt.Println(clrGreen + "  + " + clrReset + install.Lang + " " + install.Version + clrGrey + " (from " + install.From + ")" + clrReset)
+	}
+	if len(plan.Installs) == 0 {
+		fmt.Println("  - nothing to install")
+	}
+
+	fmt.Println(lstDot + "Default versions")
+	for _, lang := range sortedKeys(plan.Defaults) {
+		if pinned[lang] == true {
+			fmt.Println(clrYellow + "  ~ " + clrReset + lang + " " + plan.Defaults[lang] + clrGrey + " (kept installed, the pinned default wins)" + clrReset)
+		} else {
+			fmt.Println(clrGreen + "  = " + clrReset + lang + " " + plan.Defaults[lang])
+		}
+	}
+
+	fmt.Println(lstDot + "Remove the nvm and pyenv blocks of the installers")
+	for _, oldLine := range plan.RCLines {
+		fmt.Println(clrRed + "  - " + clrReset + oldLine.Path + ":" + strconv.Itoa(oldLine.Num) + clrGrey + "  " + oldLine.Text + clrReset)
+	}
+	if len(plan.RCLines) == 0 {
+		fmt.Println("  - nothing to remove")
+	}
+	for _, keptLine := range plan.KeptLines {
+		fmt.Println(clrYellow + "  ~ " + clrReset + keptLine.Path + ":" + strconv.Itoa(keptLine.Num) + clrGrey + "  " + keptLine.Text + "  (yours, remove it by hand)" + clrReset)
+	}
+}
+
+// removeRCLines deletes oldLines from their rc files. A file the shell could
+// parse before and can't after is put back as it was, and false is returned.
+func removeRCLines(oldLines []rcLine) bool {
+	removed := true
+	removeNums := map[string]map[int]bool{}
+	for _, oldLine := range oldLines {
+		if removeNums[oldLine.Path] == nil {
+			removeNums[oldLine.Path] = map[int]bool{}
+		}
+		removeNums[oldLine.Path][oldLine.Num] = true
+	}
+
+	for _, rcPath := range sortedKeys(removeNums) {
+		var keptLines []string
+		rcScan := bufio.NewScanner(strings.NewReader(readFileContents(rcPath)))
+		for lineNum := 1; rcScan.Scan(); lineNum++ {
+			if removeNums[rcPath][lineNum] != true {
+				keptLines = append(keptLines, rcScan.Text())
+			}
+		}
+		rcInfo, err := os.Stat(rcPath)
+		checkError(err, "Failed to get file information of \""+rcPath+"\"")
+		oldContents := readFileContents(rcPath)
+		oldSyntax := checkSyntax(rcPath, nil)
+		makeFile(rcPath, strings.Join(keptLines, "\n")+"\n", int(rcInfo.Mode().Perm()))
+		if newSyntax := checkSyntax(rcPath, nil); len(oldSyntax) == 0 && len(newSyntax) > 0 {
+			makeFile(rcPath, oldContents, int(rcInfo.Mode().Perm()))
+			messageError("print", "Removing the old lines broke \""+rcPath+"\" ("+newSyntax[0].Text+"), it is back as it was", "Shell syntax")
+			removed = false
+		}
+	}
+	return removed
+}
+
+// migrateRuntimes moves Node versions from nvm and Python versions from pyenv
+// to the configured runtime manager. The old version directories stay on disk.
+func migrateRuntimes(args []string) {
+	migrateFlags := flag.NewFlagSet("migrate runtimes", flag.ExitOnError)
+	dryRun := migrateFlags.Bool("dry-run", false, "show the plan without changing anything")
+	assumeYes := migrateFlags.Bool("yes", false, "run the plan without asking")
+	checkError(migrateFlags.Parse(args), "Failed to parse migrate runtimes options")
+
+	teamManifest := loadManifest()
+	manager := selectRuntimeManager(teamManifest.Manager)
+	pinned := map[string]bool{}
+	for _, pin := range pinnedRuntimes(teamManifest) {
+		pinned[pin.Lang] = true
+	}
+
+	fmt.Println(clrCyan + "Migrate nvm and pyenv runtimes" + clrReset)
+	plan := planRuntimeMigration(manager)
+	printMigratePlan(plan, manager, pinned)
+	if *dryRun == true {
+		return
+	} else if *assumeYes != true && answerYes(readInput("If you wish to continue type (Y) then press return: ")) != true {
+		fmt.Println(lstDot + "Migration cancelled.")
+		return
+	}
+
+	for _, install := range plan.Installs {
+		manager.Install(install.Lang, install.Version)
+	}
+	manager.Reshim()
+	for _, lang := range sortedKeys(plan.Defaults) {
+		if pinned[lang] != true {
+			manager.SetDefault(lang, plan.Defaults[lang])
+		}
+	}
+	if removeRCLines(plan.RCLines) != true {
+		fmt.Println(clrYellow + "  ~ " + clrReset + "Remove the nvm and pyenv blocks listed above by hand.")
+	}
+	userShell := loginShell()
+	writeManagedBlock(userShell.RCPath(), "runtime-manager", renderSnippet(userShell, manager.Activation(userShell.Name())...), 0644)
+	writePath(teamManifest)
+
+	fmt.Println(lstDot + "Migrated to " + manager.Name() + ". Remove \"" + nvmDir + "\" and \"" + pyenvDir + "\" when you no longer need them.")
+}
+
+// migrateASDF installs every version found in the asdf installs directory
+// again with mise. The asdf installs are left in place to remove by hand.
+func migrateASDF(args []string) {
+	migrateFlags := flag.NewFlagSet("migrate asdf", flag.ExitOnError)
+	dryRun := migrateFlags.Bool("dry-run", false, "show the versions to install without installing them")
+	checkError(migrateFlags.Parse(args), "Failed to parse migrate asdf options")
+
+	fmt.Println(clrCyan + "Migrate asdf to mise" + clrReset)
+	asdf, mise := asdfManager{}, miseManager{}
+	installDir := asdfDataDir() + "installs/"
+	pluginDirs, err := os.ReadDir(installDir)
+	checkError(err, "Failed to read asdf installs from \""+installDir+"\"")
+
+	for _, pluginDir := range pluginDirs {
+		lang := asdfLang(pluginDir.Name())
+		installed := map[string]bool{}
+		for _, version := range mise.Installed(lang) {
+			installed[version] = true
+		}
+		for _, version := range asdf.Installed(lang) {
+			if installed[version] == true {
+				fmt.Println(lstDot + lang + " " + version + clrGrey + " (already in mise)" + clrReset)
+			} else if *dryRun == true {
+				fmt.Println(lstDot + lang + " " + version + clrGreen + " (would install)" + clrReset)
+			} else {
+				fmt.Println(lstDot + lang + " " + version + clrGreen + " (installing)" + clrReset)
+				mise.Install(lang, version)
+			}
+		}
+	}
+
+	if *dryRun != true {
+		mise.Reshim()
+		fmt.Println(lstDot + "Set \"runtimeManager\": \"mise\" in \"" + manifestPath + "\" and run \"dev4os runtimes\" to switch.")
+	}
+}
+
+func migrateMain(args []string) {
+	if len(args) > 0 && args[0] == "asdf" {
+		migrateASDF(args[1:])
+	} else if len(args) > 0 && args[0] == "runtimes" {
+		migrateRuntimes(args[1:])
+	} else {
+		printUsage()
+		messageError("fatal", "Usage: dev4os migrate <asdf|runtimes> [-dry-run]", "Usage")
+	}
+}
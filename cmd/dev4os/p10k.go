@@ -0,0 +1,261 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+var (
+	p10kManagedLine = "# Generated by dev4os from dev4p10k, run \"dev4os theme p10k\" to update."
+	p10kSegmentName = regexp.MustCompile(`^[a-z0-9_]+$`)
+	// p10kASCII replaces the unicode symbols of dev4p10k for terminals
+	// without them, the way the ascii choice of "p10k configure" does.
+	p10kASCII = strings.NewReplacer(
+		"❯", ">", "❮", "<", "▶", "^", "∅", "!w", "…", "..",
+		"⇣", "<", "⇡", ">", "⇠", "<-", "⇢", "->", "─", "-",
+		"✔", "ok", "х", "x", "≡", "&", "▲", "R", "○", "k", "⭐", "*",
+		"▁", "_", "▂", ".", "▃", ":", "▄", "-", "▅", "=", "▆", "+", "▇", "#", "█", "@",
+	)
+)
+
+// p10kOptions are what can be changed in dev4p10k without editing it. An
+// empty value keeps what dev4p10k has.
+type p10kOptions struct {
+	Style           string   `json:"style"`           // compact, spaced or two-line
+	Left            []string `json:"left"`            // segments on the left
+	Right           []string `json:"right"`           // segments on the right
+	Icons           string   `json:"icons"`           // nerdfont, unicode or ascii
+	InstantPrompt   string   `json:"instantPrompt"`   // off, quiet or verbose
+	TransientPrompt string   `json:"transientPrompt"` // off, always or same-dir
+	TimeFormat      string   `json:"timeFormat"`      // strftime format of the time segment
+}
+
+func checkOption(name, value string, choices ...string) {
+	if value == "" {
+		return
+	}
+	for _, choice := range choices {
+		if value == choice {
+			return
+		}
+	}
+	messageError("fatal", "Unknown p10k "+name+" \""+value+"\", use "+strings.Join(choices, ", "), "Theme")
+}
+
+func (options p10kOptions) check() {
+	checkOption("style", options.Style, "compact", "spaced", "two-line")
+	checkOption("icons", options.Icons, "nerdfont", "unicode", "ascii")
+	checkOption("instant prompt", options.InstantPrompt, "off", "quiet", "verbose")
+	checkOption("transient prompt", options.TransientPrompt, "off", "always", "same-dir")
+	if strings.ContainsAny(options.TimeFormat, "'}") == true {
+		messageError("fatal", "p10k time format can't contain ' or }", "Theme")
+	}
+
+	knownSegments := p10kSegments(p10kBase, "LEFT", true)
+	for segment, comment := range p10kSegments(p10kBase, "RIGHT", true) {
+		knownSegments[segment] = comment
+	}
+	knownSegments["newline"] = "\\n"
+	for _, segment := range append(append([]string{}, options.Left...), options.Right...) {
+		if _, ok := knownSegments[segment]; ok != true {
+			messageError("fatal", "Unknown p10k segment \""+segment+"\"", "Theme")
+		}
+	}
+}
+
+func p10kElementsPattern(side string) *regexp.Regexp {
+	return regexp.MustCompile(`(?s)(\n  typeset -g POWERLEVEL9K_` + side + `_PROMPT_ELEMENTS=\(\n)(.*?)(\n  \)\n)`)
+}
+
+// p10kSegments reads the segments of one side of config with the comment
+// that explains each. With all set it includes the commented-out ones.
+func p10kSegments(config, side string, all bool) map[string]string {
+	segments := map[string]string{}
+	elements := p10kElementsPattern(side).FindStringSubmatch(config)
+	if elements == nil {
+		messageError("fatal", "Can't find the "+strings.ToLower(side)+" segments in dev4p10k", "Theme")
+	}
+	for _, elementLine := range strings.Split(elements[2], "\n") {
+		elementFields := strings.Fields(elementLine)
+		if len(elementFields) > 1 && elementFields[0] == "#" && all == true {
+			elementFields = elementFields[1:]
+		}
+		if len(elementFields) > 0 && p10kSegmentName.MatchString(elementFields[0]) == true {
+			segments[elementFields[0]] = strings.TrimPrefix(strings.Join(elementFields[1:], " "), "# ")
+		}
+	}
+	return segments
+}
+
+// activeSegments lists the segments one side of config shows, in order.
+func activeSegments(config, side string) []string {
+	var segments []string
+	for _, elementLine := range strings.Split(p10kElementsPattern(side).FindStringSubmatch(config)[2], "\n") {
+		if elementFields := strings.Fields(elementLine); len(elementFields) > 0 && elementFields[0] != "#" {
+			segments = append(segments, elementFields[0])
+		}
+	}
+	return segments
+}
+
+func setP10kSegments(config, side string, segments []string) string {
+	comments := p10kSegments(p10kBase, side, true)
+	comments["newline"] = "\\n"
+	var elementLines []string
+	for _, segment := range segments {
+		elementLines = append(elementLines, fmt.Sprintf("    %-23s # %s", segment, comments[segment]))
+	}
+	return p10kElementsPattern(side).ReplaceAllLiteralString(config,
+		"\n  typeset -g POWERLEVEL9K_"+side+"_PROMPT_ELEMENTS=(\n"+strings.Join(elementLines, "\n")+"\n  )\n")
+}
+
+// setP10k sets one POWERLEVEL9K_ option of config, keeping the comment after
+// it. Every option set here has to be in dev4p10k.
+func setP10k(config, name, value string) string {
+	optionPattern := regexp.MustCompile(`(?m)^(  typeset -g POWERLEVEL9K_` + regexp.QuoteMeta(name) + `=)\S*`)
+	if optionPattern.MatchString(config) != true {
+		messageError("fatal", "Can't find POWERLEVEL9K_"+name+" in dev4p10k", "Theme")
+	}
+	return optionPattern.ReplaceAllLiteralString(config, "  typeset -g POWERLEVEL9K_"+name+"="+value)
+}
+
+// renderP10k renders dev4p10k with options, starting with a comment that
+// records them like the "Wizard options" line of p10k configure.
+func renderP10k(options p10kOptions) string {
+	options.check()
+	config := p10kBase
+	leftSegments := options.Left
+	if len(leftSegments) == 0 {
+		leftSegments = activeSegments(config, "LEFT")
+	}
+	if len(options.Right) > 0 {
+		config = setP10kSegments(config, "RIGHT", options.Right)
+	}
+
+	if options.Style == "spaced" {
+		config = setP10k(config, "PROMPT_ADD_NEWLINE", "true")
+	} else if options.Style == "two-line" {
+		config = setP10k(config, "PROMPT_ADD_NEWLINE", "true")
+		var twoLineSegments []string
+		hasNewline := false
+		for _, segment := range leftSegments {
+			if segment == "prompt_char" && (len(twoLineSegments) == 0 || twoLineSegments[len(twoLineSegments)-1] != "newline") {
+				twoLineSegments = append(twoLineSegments, "newline")
+			}
+			twoLineSegments = append(twoLineSegments, segment)
+			hasNewline = hasNewline || segment == "newline" || segment == "prompt_char"
+		}
+		// Without prompt_char nothing marks where the second line starts, so
+		// it is left empty for the command.
+		if hasNewline != true {
+			twoLineSegments = append(twoLineSegments, "newline")
+		}
+		leftSegments = twoLineSegments
+	}
+	if len(options.Left) > 0 || options.Style == "two-line" {
+		config = setP10kSegments(config, "LEFT", leftSegments)
+	}
+
+	if options.Icons == "nerdfont" {
+		config = setP10k(config, "MODE", "nerdfont-complete")
+		config = setP10k(config, "ICON_PADDING", "moderate")
+		// Only a plain name is matched: the brace-expanded NORDVPN line hides
+		// the segment while disconnected, which nerdfont icons must not undo.
+		config = regexp.MustCompile(`(?m)^  typeset -g POWERLEVEL9K_[A-Z0-9_]+_VISUAL_IDENTIFIER_EXPANSION=\n`).ReplaceAllLiteralString(config, "")
+	} else if options.Icons == "ascii" {
+		config = setP10k(config, "MODE", "ascii")
+		configLines := strings.Split(config, "\n")
+		for lineNum, configLine := range configLines {
+			if strings.HasPrefix(strings.TrimSpace(configLine), "#") != true {
+				configLines[lineNum] = p10kASCII.Replace(configLine)
+			}
+		}
+		config = strings.Join(configLines, "\n")
+	}
+	if options.InstantPrompt != "" {
+		config = setP10k(config, "INSTANT_PROMPT", options.InstantPrompt)
+	}
+	if options.TransientPrompt != "" {
+		config = setP10k(config, "TRANSIENT_PROMPT", options.TransientPrompt)
+	}
+	if options.TimeFormat != "" {
+		config = setP10k(config, "TIME_FORMAT", "'%D{"+options.TimeFormat+"}'")
+	}
+
+	optionsLine := "# dev4os options: style=" + options.Style + ", icons=" + options.Icons +
+		", instant_prompt=" + options.InstantPrompt + ", transient_prompt=" + options.TransientPrompt +
+		", time=" + options.TimeFormat + ".\n"
+	return optionsLine + config
+}
+
+// checkP10k runs the config through zsh -n when zsh is installed, so a bad
+// option never reaches a new shell.
+func checkP10k(config string) {
+	if _, err := exec.LookPath("zsh"); err != nil {
+		return
+	}
+	checkZsh := exec.Command("zsh", "-n")
+	checkZsh.Stdin = strings.NewReader(config)
+	zshOut, err := checkZsh.CombinedOutput()
+	if err != nil {
+		messageError("fatal", "Rendered p10k config has a syntax error: "+strings.TrimSpace(string(zshOut)), "Theme")
+	}
+}
+
+func splitSegments(segments string) []string {
+	var segmentList []string
+	for _, segment := range strings.Split(segments, ",") {
+		if strings.TrimSpace(segment) != "" {
+			segmentList = append(segmentList, strings.TrimSpace(segment))
+		}
+	}
+	return segmentList
+}
+
+// savedP10k is options with what "dev4os theme p10k" last set in place of
+// it, so "dev4os theme" keeps the options of the flags.
+func savedP10k(options p10kOptions) p10kOptions {
+	loadState("p10k.json", &options)
+	return options
+}
+
+// confP10k renders dev4p10k with the options of the theme and the flags into
+// the p10k presets the theme block sources, and makes p10k the prompt. With
+// -o it writes one file instead, where a file from "p10k configure" is kept
+// unless force is set.
+func confP10k(args []string) {
+	theme := appliedTheme(loadManifest()).renamePresets()
+	options := savedP10k(theme.P10k)
+	p10kFlags := flag.NewFlagSet("theme p10k", flag.ExitOnError)
+	style := p10kFlags.String("style", options.Style, "compact, spaced or two-line")
+	left := p10kFlags.String("left", strings.Join(options.Left, ","), "comma separated segments on the left")
+	right := p10kFlags.String("right", strings.Join(options.Right, ","), "comma separated segments on the right")
+	icons := p10kFlags.String("icons", options.Icons, "nerdfont, unicode or ascii")
+	instantPrompt := p10kFlags.String("instant-prompt", options.InstantPrompt, "off, quiet or verbose")
+	transientPrompt := p10kFlags.String("transient-prompt", options.TransientPrompt, "off, always or same-dir")
+	timeFormat := p10kFlags.String("time", options.TimeFormat, "strftime format of the time segment")
+	outPath := p10kFlags.String("o", "", "file to write instead of the theme presets")
+	force := p10kFlags.Bool("force", false, "replace a config not generated by dev4os")
+	checkError(p10kFlags.Parse(args), "Failed to parse theme p10k options")
+
+	options = p10kOptions{*style, splitSegments(*left), splitSegments(*right), *icons, *instantPrompt, *transientPrompt, *timeFormat}
+	if *outPath == "" {
+		theme.Backend = "p10k"
+		theme.P10k = options
+		applyTheme(theme)
+		saveState("p10k.json", options)
+		return
+	}
+	fmt.Println(clrCyan + "Powerlevel10k config" + clrReset)
+	if strings.HasPrefix(readFileContents(*outPath), p10kManagedLine) != true && checkExists(*outPath) == true && *force != true {
+		fmt.Println(clrYellow + "  ~ " + clrReset + "\"" + *outPath + "\" is not generated by dev4os, run \"dev4os theme p10k -o " + *outPath + " -force\" to replace it")
+		return
+	}
+	p10kConfig := p10kManagedLine + "\n" + renderP10k(options)
+	checkP10k(p10kConfig)
+	makeFile(*outPath, p10kConfig, 0644)
+	fmt.Println(lstDot + "Rendered \"" + *outPath + "\" with " + clrPurple + *icons + clrReset + " icons and " + clrPurple + *style + clrReset + " style.")
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// p10kChanges lists the lines config adds to dev4p10k with "+" and the lines
+// it drops with "-", so a golden file shows what the options changed and not
+// the 1600 lines they leave alone.
+func p10kChanges(config string) string {
+	baseLines := map[string]int{}
+	for _, baseLine := range strings.Split(p10kBase, "\n") {
+		baseLines[baseLine]++
+	}
+	var changes []string
+	for _, configLine := range strings.Split(config, "\n") {
+		if baseLines[configLine] > 0 {
+			baseLines[configLine]--
+		} else {
+			changes = append(changes, "+"+configLine)
+		}
+	}
+	for _, baseLine := range strings.Split(p10kBase, "\n") {
+		if baseLines[baseLine] > 0 {
+			baseLines[baseLine]--
+			changes = append(changes, "-"+baseLine)
+		}
+	}
+	return strings.Join(changes, "\n") + "\n"
+}
+
+// checkP10kGolden renders options and compares what they change in dev4p10k
+// with testdata/p10k/<caseName>.golden.
+func checkP10kGolden(t *testing.T, caseName string, options p10kOptions) {
+	config := renderP10k(options)
+	if strings.Contains(config, "  typeset -g POWERLEVEL9K_NORDVPN_{DISCONNECTED,CONNECTING,DISCONNECTING}_VISUAL_IDENTIFIER_EXPANSION=\n") != true {
+		t.Error("the NORDVPN line that hides the disconnected states is gone")
+	}
+	if _, err := exec.LookPath("zsh"); err == nil {
+		checkZsh := exec.Command("zsh", "-n")
+		checkZsh.Stdin = strings.NewReader(config)
+		if zshOut, err := checkZsh.CombinedOutput(); err != nil {
+			t.Errorf("zsh -n: %v\n%s", err, zshOut)
+		}
+	}
+
+	goldenPath := filepath.Join("testdata", "p10k", caseName+".golden")
+	changes := p10kChanges(config)
+	if *updateGolden == true {
+		if err := os.WriteFile(goldenPath, []byte(changes), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	golden, err := os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatalf("%v, run \"go test -run TestRenderP10kGolden -update\" to write it", err)
+	}
+	if changes != string(golden) {
+		t.Errorf("rendered config differs from %s:\n%s", goldenPath, changes)
+	}
+}
+
+func TestRenderP10kGolden(t *testing.T) {
+	for _, style := range []string{"compact", "spaced", "two-line"} {
+		for _, icons := range []string{"nerdfont", "unicode", "ascii"} {
+			for _, instantPrompt := range []string{"off", "quiet", "verbose"} {
+				for _, transientPrompt := range []string{"off", "always", "same-dir"} {
+					options := p10kOptions{Style: style, Icons: icons, InstantPrompt: instantPrompt, TransientPrompt: transientPrompt}
+					caseName := strings.Join([]string{style, icons, instantPrompt, transientPrompt}, "_")
+					t.Run(caseName, func(t *testing.T) {
+						checkP10kGolden(t, caseName, options)
+					})
+				}
+			}
+		}
+	}
+
+	tests := []struct {
+		caseName string
+		options  p10kOptions
+	}{
+		{"left", p10kOptions{Left: []string{"dir", "vcs", "prompt_char"}}},
+		{"left_two-line", p10kOptions{Style: "two-line", Left: []string{"os_icon", "dir", "vcs", "prompt_char"}}},
+		{"left_two-line_no-prompt-char", p10kOptions{Style: "two-line", Left: []string{"dir", "vcs"}}},
+		{"left_two-line_own-newline", p10kOptions{Style: "two-line", Left: []string{"dir", "newline", "vcs"}}},
+		{"right", p10kOptions{Right: []string{"status", "command_execution_time", "time"}}},
+		{"time-format", p10kOptions{TimeFormat: "%H:%M"}},
+		{"left_right_time-format", p10kOptions{Style: "spaced", Icons: "ascii", Left: []string{"dir", "prompt_char"}, Right: []string{"time"}, TimeFormat: "%I:%M %p"}},
+	}
+	for _, test := range tests {
+		t.Run(test.caseName, func(t *testing.T) {
+			checkP10kGolden(t, test.caseName, test.options)
+		})
+	}
+}
+
+func TestRenderP10kTwoLine(t *testing.T) {
+	for _, left := range [][]string{nil, {"dir", "vcs"}, {"dir", "prompt_char"}} {
+		config := renderP10k(p10kOptions{Style: "two-line", Left: left})
+		segments := activeSegments(config, "LEFT")
+		newlineCount := 0
+		for _, segment := range segments {
+			if segment == "newline" {
+				newlineCount++
+			}
+		}
+		if newlineCount != 1 {
+			t.Errorf("two-line with left %q renders %q, want one newline", left, segments)
+		}
+	}
+}
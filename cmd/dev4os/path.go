@@ -0,0 +1,173 @@
+package main
+
+import (
+	"dev4os/shellrc"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// pathEntry is a directory a component puts on PATH. Entries with a higher
+// priority come first, and Dir may use $HOME or a variable set by the
+// component's own block.
+type pathEntry struct {
+	Component string `json:"component"`
+	Dir       string `json:"dir"`
+	Priority  int    `json:"priority"`
+}
+
+// brewKegPaths are the bin directories of the keg-only Homebrew packages
+// dev4mac installs, which Homebrew does not link into its own bin, and
+// androidSDKPaths the tool directories of the Android SDK it sets up.
+var (
+	brewKegPaths = []string{
+		"ncurses/bin", "openssl@3/bin", "openssl@1.1/bin", "krb5/bin", "krb5/sbin", "gnu-getopt/bin",
+		"tcl-tk/bin", "bzip2/bin", "bison/bin", "icu4c/bin", "icu4c/sbin", "libiconv/bin",
+		"libxml2/bin", "libxslt/bin", "curl/bin", "sqlite/bin", "ccache/libexec", "ruby/bin",
+	}
+	androidSDKPaths = []string{"emulator", "tools", "tools/bin", "platform-tools"}
+)
+
+func brewPrefix() string {
+	if runtime.GOARCH == "arm64" {
+		return "/opt/homebrew/"
+	}
+	return "/usr/local/"
+}
+
+// pathEntries collects the entries of every component. A dev4os component
+// only counts when its block is in the rc file, so PATH follows what was
+// actually set up.
+func pathEntries(teamManifest manifest) []pathEntry {
+	var entries []pathEntry
+	_, rcBlocks := splitManaged(readFileContents(loginShell().RCPath()))
+
+	for _, userDir := range []string{".local/bin", "bin"} {
+		if checkExists(homeDir()+userDir) == true {
+			entries = append(entries, pathEntry{"user", "$HOME/" + userDir, 100})
+		}
+	}
+	if _, ok := rcBlocks["runtime-manager"]; ok == true {
+		for _, managerDir := range selectRuntimeManager(teamManifest.Manager).Paths() {
+			entries = append(entries, pathEntry{"runtime-manager", managerDir, 90})
+		}
+	}
+	if _, ok := rcBlocks["java-home"]; ok == true {
+		entries = append(entries, pathEntry{"java", "$JAVA_HOME/bin", 80})
+	}
+	if _, ok := rcBlocks["language-env"]; ok == true {
+		entries = append(entries, langEnvPaths(teamManifest)...)
+	}
+	for _, teamEntry := range teamManifest.Path {
+		if strings.HasPrefix(teamEntry.Dir, "~/") {
+			teamEntry.Dir = "$HOME/" + teamEntry.Dir[2:]
+		}
+		entries = append(entries, teamEntry)
+	}
+	if runtime.GOOS == "darwin" {
+		for _, kegPath := range brewKegPaths {
+			if checkExists(brewPrefix()+"opt/"+kegPath) == true {
+				entries = append(entries, pathEntry{"homebrew", brewPrefix() + "opt/" + kegPath, 50})
+			}
+		}
+		for _, sdkPath := range androidSDKPaths {
+			if checkExists(homeDir()+"Library/Android/sdk/"+sdkPath) == true {
+				entries = append(entries, pathEntry{"android", "$HOME/Library/Android/sdk/" + sdkPath, 10})
+			}
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Priority > entries[j].Priority })
+	return entries
+}
+
+// uniquePaths drops entries whose directory is already on PATH from an entry
+// with a higher priority.
+func uniquePaths(entries []pathEntry) []pathEntry {
+	var unique []pathEntry
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		if seen[entry.Dir] != true {
+			seen[entry.Dir] = true
+			unique = append(unique, entry)
+		}
+	}
+	return unique
+}
+
+// writePath regenerates the path block and keeps it last in the rc file, after
+// the blocks that set the variables it uses.
+func writePath(teamManifest manifest) {
+	userShell := loginShell()
+	rcPath := userShell.RCPath()
+	var pathDirs []string
+	for _, entry := range uniquePaths(pathEntries(teamManifest)) {
+		pathDirs = append(pathDirs, entry.Dir)
+	}
+	rcContents := removeBlock(readFileContents(rcPath), "path")
+	if len(pathDirs) > 0 {
+		rcContents = replaceBlock(rcContents, "path", renderSnippet(userShell, shellrc.Path(pathDirs...)))
+	}
+	makeFile(rcPath, rcContents, 0644)
+}
+
+// pathVars resolves the variables the entries use the way the rc file sets
+// them, since the shell running dev4os may not have sourced it yet.
+func pathVars(teamManifest manifest) map[string]string {
+	_, rcBlocks := splitManaged(readFileContents(loginShell().RCPath()))
+	pathVars := map[string]string{
+		"HOME":          strings.TrimSuffix(homeDir(), "/"),
+		"ASDF_DATA_DIR": strings.TrimSuffix(asdfDataDir(), "/"),
+	}
+	for envName, envValue := range langEnvVars(teamManifest) {
+		pathVars[envName] = expandHome(envValue)
+	}
+	for _, javaLine := range strings.Split(rcBlocks["java-home"], "\n") {
+		if javaFields := strings.SplitN(strings.TrimPrefix(javaLine, "set -gx "), "JAVA_HOME", 2); len(javaFields) == 2 {
+			pathVars["JAVA_HOME"] = strings.Trim(javaFields[1], "=\" ")
+		}
+	}
+	return pathVars
+}
+
+func explainPath() {
+	teamManifest := loadManifest()
+	fmt.Println(clrCyan + "PATH entries" + clrReset + " in \"" + loginShell().RCPath() + "\"")
+	knownVars := pathVars(teamManifest)
+	expandVar := func(varName string) string {
+		if varValue, ok := knownVars[varName]; ok == true {
+			return varValue
+		}
+		return os.Getenv(varName)
+	}
+
+	seen := map[string]string{}
+	for _, entry := range pathEntries(teamManifest) {
+		entryLine := fmt.Sprintf("%5s  %-16s %s", strconv.Itoa(entry.Priority), entry.Component, entry.Dir)
+		if seenBy, ok := seen[entry.Dir]; ok == true {
+			fmt.Println(clrGrey + entryLine + " (already added by " + seenBy + ")" + clrReset)
+			continue
+		}
+		seen[entry.Dir] = entry.Component
+		if checkExists(os.Expand(entry.Dir, expandVar)) != true {
+			fmt.Println(entryLine + clrYellow + " (missing)" + clrReset)
+		} else {
+			fmt.Println(entryLine)
+		}
+	}
+}
+
+func pathMain(args []string) {
+	if len(args) == 0 {
+		writePath(loadManifest())
+		fmt.Println(lstDot + "PATH set in \"" + loginShell().RCPath() + "\".")
+	} else if args[0] == "explain" {
+		explainPath()
+	} else {
+		printUsage()
+		messageError("fatal", "Unknown path command \""+args[0]+"\"", "Usage")
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"dev4os/shellrc"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// tracePattern matches the PS4 dev4os sets while tracing: the time, file
+	// and line of every command the shell runs.
+	tracePattern = regexp.MustCompile(`^\++(\d+[.,]\d+)\|(.*):(\d+)> `)
+	// lazyBlocks suggests a cheaper way to load each slow managed block.
+	lazyBlocks = map[string]string{
+		"runtime-manager": "Put the manager's shims directory on PATH with \"dev4os path\" and drop its shell hook, or switch to mise which activates lazily",
+		"zsh-plugins":     "Load plugins after the first prompt with zsh-defer or antidote's kind:defer, and run compinit -C to skip the audit",
+		"theme":           "Keep the p10k instant prompt block first in .zshrc, so the prompt shows before the rest loads",
+		"ssh-agent":       "Start the agent once in the profile file, interactive shells can reuse $SSH_AUTH_SOCK",
+		"aliases":         "Move rarely used functions to autoload files so they are read on first use",
+		"language-env":    "Nothing in this block should be slow, check the commands it substitutes",
+	}
+	// slowCommands suggests a lazy-loading pattern for the usual slow lines
+	// in a user's own part of the rc file.
+	slowCommands = map[string]string{
+		"nvm.sh":             "Replace the nvm lines with \"dev4os migrate runtimes\", or wrap nvm, node and npm in functions that source nvm.sh on first use",
+		"pyenv init":         "Replace the pyenv lines with \"dev4os migrate runtimes\", or keep only pyenv's shims directory on PATH",
+		"rbenv init":         "Keep only rbenv's shims directory on PATH instead of \"rbenv init\"",
+		"conda":              "Use \"conda init --reverse\" and activate conda from a function when a project needs it",
+		"compinit":           "Run compinit once with -C, or let the zsh plugin block do it",
+		"neofetch":           "Run neofetch from the profile file of login shells only, not in every new tab",
+		"brew shellenv":      "Write the output of \"brew shellenv\" once instead of running it in every shell",
+		"kubectl completion": "Cache the completion script in a file and source that file",
+	}
+)
+
+// startupCost is the time of one managed block or one of the user's lines,
+// summed over every run. Text is the user's line.
+type startupCost struct {
+	Label string
+	Block string
+	Text  string
+	Time  time.Duration
+}
+
+// startupFiles are the files the shell reads when a new interactive shell
+// starts, the ones time is attributed to.
+func startupFiles(userShell shell) []string {
+	switch userShell.Name() {
+	case "zsh":
+		zshDir := envDir("ZDOTDIR", homeDir())
+		return []string{zshDir + ".zshenv", zshDir + ".zprofile", zshDir + ".zshrc", zshDir + ".zlogin"}
+	case "fish":
+		return []string{fishShell{}.RCPath()}
+	}
+	return []string{bashShell{}.RCPath()}
+}
+
+// traceCommand starts an interactive shell that writes a time stamp, file and
+// line for every command to stderr, through a startup file in traceDir that
+// turns tracing on and then reads the user's files.
+func traceCommand(userShell shell, traceDir string) *exec.Cmd {
+	if userShell.Name() == "zsh" {
+		zshDir := envDir("ZDOTDIR", homeDir())
+		makeFile(traceDir+".zshenv", "PS4='+%D{%s.%6.}|%x:%I> '\n"+
+			"setopt xtrace\n"+
+			"ZDOTDIR=\""+strings.TrimSuffix(zshDir, "/")+"\"\n"+
+			"[ -f \"$ZDOTDIR/.zshenv\" ] && source \"$ZDOTDIR/.zshenv\"\n", 0644)
+		traceShell := exec.Command("zsh", "-l", "-i", "-c", "exit")
+		traceShell.Env = append(os.Environ(), "ZDOTDIR="+strings.TrimSuffix(traceDir, "/"))
+		return traceShell
+	}
+	makeFile(traceDir+"bashrc", "PS4='+${EPOCHREALTIME}|${BASH_SOURCE}:${LINENO}> '\n"+
+		"set -x\n"+
+		renderSnippet(userShell, shellrc.Source(bashShell{}.RCPath())), 0644)
+	return exec.Command("bash", "--rcfile", traceDir+"bashrc", "-i", "-c", "exit")
+}
+
+// fileLines caches the lines and managed block names of the startup files.
+type fileLines struct {
+	Lines  map[string][]string
+	Blocks map[string][]string
+}
+
+func readStartupFiles(userShell shell) fileLines {
+	startup := fileLines{map[string][]string{}, map[string][]string{}}
+	for _, startupPath := range startupFiles(userShell) {
+		if contents := readFileContents(startupPath); contents != "" {
+			startup.Lines[startupPath] = strings.Split(strings.TrimRight(contents, "\n"), "\n")
+			startup.Blocks[startupPath] = lineBlocks(contents)
+		}
+	}
+	return startup
+}
+
+// costOf names the part of a startup file a line is in: its managed block,
+// or the line itself when it is the user's.
+func (startup fileLines) costOf(filePath string, lineNum int) startupCost {
+	fileBlocks := startup.Blocks[filePath]
+	if lineNum < 1 || lineNum > len(fileBlocks) {
+		return startupCost{Label: filepath.Base(filePath)}
+	} else if fileBlocks[lineNum-1] != "" {
+		return startupCost{Label: "dev4os " + fileBlocks[lineNum-1], Block: fileBlocks[lineNum-1]}
+	}
+	return startupCost{Label: filepath.Base(filePath) + ":" + strconv.Itoa(lineNum), Text: strings.TrimSpace(startup.Lines[filePath][lineNum-1])}
+}
+
+// attributeTrace gives the time until the next traced command to the startup
+// file line that runs it. Commands of a file those lines source count for
+// the line that sourced it.
+func attributeTrace(traceOut string, startup fileLines, costs map[string]*startupCost) {
+	current := startupCost{Label: "shell itself"}
+	lastTime := 0.0
+	for _, traceLine := range strings.Split(traceOut, "\n") {
+		traceMatch := tracePattern.FindStringSubmatch(traceLine)
+		if traceMatch == nil {
+			continue
+		}
+		traceTime, err := strconv.ParseFloat(strings.Replace(traceMatch[1], ",", ".", 1), 64)
+		if err != nil {
+			continue
+		}
+		if lastTime > 0 {
+			if costs[current.Label] == nil {
+				costs[current.Label] = &startupCost{Label: current.Label, Block: current.Block, Text: current.Text}
+			}
+			costs[current.Label].Time += time.Duration((traceTime - lastTime) * float64(time.Second))
+		}
+		lastTime = traceTime
+
+		if _, ok := startup.Lines[filepath.Clean(traceMatch[2])]; ok == true {
+			lineNum, _ := strconv.Atoi(traceMatch[3])
+			current = startup.costOf(filepath.Clean(traceMatch[2]), lineNum)
+		}
+	}
+}
+
+// attributeFishProfile reads the output of fish --profile-startup. Every
+// statement of config.fish is matched to its line by its text.
+func attributeFishProfile(profileOut string, startup fileLines, costs map[string]*startupCost) {
+	configPath := fishShell{}.RCPath()
+	configDepth := -1
+	for _, profileLine := range strings.Split(profileOut, "\n") {
+		profileFields := strings.SplitN(profileLine, "\t", 3)
+		if len(profileFields) < 3 || strings.Contains(profileFields[2], ">") != true {
+			continue
+		}
+		sumTime, err := strconv.Atoi(strings.TrimSpace(profileFields[1]))
+		if err != nil {
+			continue
+		}
+		commandDepth := strings.Index(profileFields[2], ">")
+		command := strings.TrimSpace(profileFields[2][commandDepth+1:])
+		if strings.Contains(command, "source") && strings.Contains(command, configPath) {
+			configDepth = commandDepth
+			continue
+		} else if configDepth < 0 || commandDepth != configDepth+1 {
+			if commandDepth <= configDepth {
+				configDepth = -1
+			}
+			continue
+		}
+
+		for lineNum, configLine := range startup.Lines[configPath] {
+			if configLine = strings.TrimSpace(configLine); configLine != "" && strings.HasPrefix(command, configLine) {
+				cost := startup.costOf(configPath, lineNum+1)
+				if costs[cost.Label] == nil {
+					costs[cost.Label] = &cost
+				}
+				costs[cost.Label].Time += time.Duration(sumTime) * time.Microsecond
+				break
+			}
+		}
+	}
+}
+
+// traceStartup starts the shell runs times and returns what each part of
+// its startup files took on average, and the average startup time.
+func traceStartup(userShell shell, runs int) ([]startupCost, time.Duration) {
+	if _, err := exec.LookPath(userShell.Name()); err != nil {
+		messageError("fatal", "Can't find "+userShell.Name()+" to profile", "Shell profile")
+	}
+	traceDir, err := os.MkdirTemp("", "dev4os-profile")
+	checkError(err, "Failed to make a directory for the startup trace")
+	defer os.RemoveAll(traceDir)
+	traceDir += "/"
+
+	startup := readStartupFiles(userShell)
+	costs := map[string]*startupCost{}
+	var totalTime time.Duration
+	for run := 0; run < runs; run++ {
+		var traceShell *exec.Cmd
+		if userShell.Name() == "fish" {
+			traceShell = exec.Command("fish", "--profile-startup="+traceDir+"fish.prof", "-i", "-c", "exit")
+		} else {
+			traceShell = traceCommand(userShell, traceDir)
+		}
+		var traceErr strings.Builder
+		traceShell.Stderr = &traceErr
+		startTime := time.Now()
+		checkCmdError(traceShell.Run(), "Startup trace ended with an error in", userShell.Name())
+		totalTime += time.Since(startTime)
+
+		if userShell.Name() == "fish" {
+			attributeFishProfile(readFileContents(traceDir+"fish.prof"), startup, costs)
+		} else {
+			attributeTrace(traceErr.String(), startup, costs)
+		}
+	}
+
+	var sortedCosts []startupCost
+	for _, cost := range costs {
+		cost.Time /= time.Duration(runs)
+		sortedCosts = append(sortedCosts, *cost)
+	}
+	sort.SliceStable(sortedCosts, func(i, j int) bool {
+		return sortedCosts[i].Time > sortedCosts[j].Time
+	})
+	return sortedCosts, totalTime / time.Duration(runs)
+}
+
+func lazySuggestion(cost startupCost) string {
+	if cost.Block != "" {
+		return lazyBlocks[cost.Block]
+	}
+	for _, slowCommand := range sortedKeys(slowCommands) {
+		if strings.Contains(cost.Text, slowCommand) {
+			return slowCommands[slowCommand]
+		}
+	}
+	if strings.Contains(cost.Text, "eval") {
+		return "Cache the output of the eval in a file and source that file"
+	}
+	return ""
+}
+
+func milliseconds(duration time.Duration) string {
+	return strconv.FormatFloat(float64(duration)/float64(time.Millisecond), 'f', 1, 64) + " ms"
+}
+
+// profileShell shows where the startup time of the login shell goes, by
+// managed block and by the user's own lines, and how to load the slowest
+// ones lazily.
+func profileShell(args []string) {
+	profileFlags := flag.NewFlagSet("shell profile", flag.ExitOnError)
+	runs := profileFlags.Int("runs", 5, "number of shells to start")
+	shellName := profileFlags.String("shell", loginShell().Name(), "shell to profile, bash, zsh or fish")
+	top := profileFlags.Int("top", 10, "number of parts to show")
+	checkError(profileFlags.Parse(args), "Failed to parse shell profile options")
+	if *runs < 1 {
+		*runs = 1
+	}
+
+	userShell := shellByName(*shellName)
+	fmt.Println(clrCyan + "Shell startup" + clrReset + " of " + clrPurple + userShell.Name() + clrReset + ", " + strconv.Itoa(*runs) + " runs")
+	costs, totalTime := traceStartup(userShell, *runs)
+	fmt.Println(lstDot + "A new shell takes " + clrPurple + milliseconds(totalTime) + clrReset + " on average with tracing on.")
+
+	var slowCosts []startupCost
+	for costNum, cost := range costs {
+		if costNum >= *top {
+			break
+		}
+		share := 0.0
+		if totalTime > 0 {
+			share = float64(cost.Time) / float64(totalTime) * 100
+		}
+		fmt.Printf("  %10s %5.1f%%  %s %s\n", milliseconds(cost.Time), share, cost.Label, clrGrey+cost.Text+clrReset)
+		if (share >= 10 || cost.Time >= 30*time.Millisecond) && lazySuggestion(cost) != "" {
+			slowCosts = append(slowCosts, cost)
+		}
+	}
+
+	if len(slowCosts) == 0 {
+		fmt.Println(lstDot + "Nothing takes long enough to be worth loading lazily.")
+		return
+	}
+	fmt.Println(clrCyan + "Suggestions" + clrReset)
+	for _, cost := range slowCosts {
+		fmt.Println(lstDot + clrYellow + cost.Label + clrReset + ": " + lazySuggestion(cost))
+	}
+}
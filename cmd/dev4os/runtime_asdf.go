@@ -0,0 +1,148 @@
+package main
+
+import (
+	"dev4os/shellrc"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+var (
+	toolVersionsPath = homeDir() + ".tool-versions"
+	asdfPlugins      = map[string]string{
+		"go":   "golang",
+		"node": "nodejs",
+	}
+)
+
+type asdfManager struct{}
+
+func asdfDataDir() string {
+	return envDir("ASDF_DATA_DIR", homeDir()+".asdf/")
+}
+
+func asdfPlugin(lang string) string {
+	if plugin, ok := asdfPlugins[lang]; ok == true {
+		return plugin
+	}
+	return lang
+}
+
+func asdfLang(plugin string) string {
+	for lang, langPlugin := range asdfPlugins {
+		if langPlugin == plugin {
+			return lang
+		}
+	}
+	return plugin
+}
+
+func asdfPath() string {
+	if asdfCmd, err := exec.LookPath("asdf"); err == nil {
+		return asdfCmd
+	} else if checkExists(asdfDataDir()+"bin/asdf") == true {
+		return asdfDataDir() + "bin/asdf"
+	}
+	messageError("fatal", "Can't find asdf, install it with dev4mac, dev4deb or dev4rpm first", "ASDF-VM")
+	return ""
+}
+
+func (asdfManager) Name() string {
+	return "asdf"
+}
+
+func (asdfManager) Install(lang, version string) {
+	plugin := asdfPlugin(lang)
+	if checkExists(asdfDataDir()+"plugins/"+plugin) != true {
+		asdfPluginAdd := exec.Command(asdfPath(), "plugin", "add", plugin)
+		checkCmdError(asdfPluginAdd.Run(), "ASDF-VM failed to add", plugin)
+	}
+
+	asdfIns := exec.Command(asdfPath(), "install", plugin, version)
+	asdfIns.Env = os.Environ()
+	asdfIns.Stderr = os.Stderr
+	checkCmdError(asdfIns.Run(), "ASDF-VM failed to install", plugin+" "+version)
+}
+
+func (asdfManager) Installed(lang string) []string {
+	return listVersionDirs(asdfDataDir() + "installs/" + asdfPlugin(lang))
+}
+
+func (asdfManager) Reshim() {
+	reshim := exec.Command(asdfPath(), "reshim")
+	checkCmdError(reshim.Run(), "ASDF failed to", "reshim")
+}
+
+// renderToolVersions writes one line per plugin with the default version
+// first. Lines of plugins that are not pinned are kept as the user wrote them.
+func renderToolVersions(pins []runtimePin, oldContents string) string {
+	var pinLines, userLines []string
+	pinnedPlugins := map[string]bool{}
+	for _, pin := range pins {
+		pinnedPlugins[asdfPlugin(pin.Lang)] = true
+		pinLines = append(pinLines, asdfPlugin(pin.Lang)+" "+strings.Join(pin.Versions, " "))
+	}
+
+	oldLines, _ := splitManaged(oldContents)
+	for _, oldLine := range oldLines {
+		if lineFields := strings.Fields(oldLine); len(lineFields) > 0 && pinnedPlugins[lineFields[0]] != true {
+			userLines = append(userLines, oldLine)
+		}
+	}
+
+	newContents := renderBlock("runtimes", strings.Join(pinLines, "\n"))
+	if len(userLines) > 0 {
+		newContents += strings.Join(userLines, "\n") + "\n"
+	}
+	return newContents
+}
+
+// SetDefault edits the user's line of the plugin, outside the managed block.
+func (asdfManager) SetDefault(lang, version string) {
+	plugin := asdfPlugin(lang)
+	var toolLines []string
+	inBlock, replaced := false, false
+	for _, toolLine := range strings.Split(strings.TrimRight(readFileContents(toolVersionsPath), "\n"), "\n") {
+		if toolLine == blockBegin("runtimes") || toolLine == blockEnd("runtimes") {
+			inBlock = toolLine == blockBegin("runtimes")
+		} else if inBlock != true && strings.HasPrefix(toolLine, plugin+" ") {
+			toolLine = plugin + " " + version
+			replaced = true
+		}
+		if toolLine != "" {
+			toolLines = append(toolLines, toolLine)
+		}
+	}
+	if replaced != true {
+		toolLines = append(toolLines, plugin+" "+version)
+	}
+	makeFile(toolVersionsPath, strings.Join(toolLines, "\n")+"\n", 0644)
+}
+
+func (asdfManager) WritePins(pins []runtimePin) string {
+	makeFile(toolVersionsPath, renderToolVersions(pins, readFileContents(toolVersionsPath)), 0644)
+	return toolVersionsPath
+}
+
+// Command runs the shim with ASDF_<PLUGIN>_VERSION set, which takes priority
+// over every .tool-versions file.
+func (asdfManager) Command(lang, version string, args ...string) *exec.Cmd {
+	cmdName := args[0]
+	if checkExists(asdfDataDir()+"shims/"+cmdName) == true {
+		cmdName = asdfDataDir() + "shims/" + cmdName
+	}
+	asdfCmd := exec.Command(cmdName, args[1:]...)
+	versionEnv := "ASDF_" + strings.ToUpper(strings.ReplaceAll(asdfPlugin(lang), "-", "_")) + "_VERSION"
+	asdfCmd.Env = append(os.Environ(), versionEnv+"="+version)
+	return asdfCmd
+}
+
+func (asdfManager) Activation(shellName string) []shellrc.Line {
+	return []shellrc.Line{shellrc.Default("ASDF_DATA_DIR", "$HOME/.asdf")}
+}
+
+// Paths puts the shims on PATH, which works for both the shell based asdf up
+// to 0.15 and the single binary from 0.16 on.
+func (asdfManager) Paths() []string {
+	return []string{"$ASDF_DATA_DIR/shims", "$ASDF_DATA_DIR/bin"}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"dev4os/shellrc"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+type miseManager struct{}
+
+func miseDataDir() string {
+	return envDir("MISE_DATA_DIR", envDir("XDG_DATA_HOME", homeDir()+".local/share/")+"mise/")
+}
+
+// misePinPath is a conf.d file, so the user's own config.toml is never touched.
+func misePinPath() string {
+	return envDir("MISE_CONFIG_DIR", envDir("XDG_CONFIG_HOME", homeDir()+".config/")+"mise/") + "conf.d/dev4os.toml"
+}
+
+// miseGlobalPath is the config "mise use --global" writes.
+func miseGlobalPath() string {
+	if globalPath := os.Getenv("MISE_GLOBAL_CONFIG_FILE"); globalPath != "" {
+		return globalPath
+	}
+	return envDir("MISE_CONFIG_DIR", envDir("XDG_CONFIG_HOME", homeDir()+".config/")+"mise/") + "config.toml"
+}
+
+func misePath() string {
+	if miseCmd, err := exec.LookPath("mise"); err == nil {
+		return miseCmd
+	} else if checkExists(homeDir()+".local/bin/mise") == true {
+		return homeDir() + ".local/bin/mise"
+	}
+	messageError("fatal", "Can't find mise, install it from https://mise.jdx.dev first", "mise")
+	return ""
+}
+
+func (miseManager) Name() string {
+	return "mise"
+}
+
+func (miseManager) Install(lang, version string) {
+	miseIns := exec.Command(misePath(), "install", lang+"@"+version)
+	miseIns.Env = os.Environ()
+	miseIns.Stderr = os.Stderr
+	checkCmdError(miseIns.Run(), "mise failed to install", lang+" "+version)
+}
+
+func (miseManager) Installed(lang string) []string {
+	return listVersionDirs(miseDataDir() + "installs/" + lang)
+}
+
+func (miseManager) Reshim() {
+	reshim := exec.Command(misePath(), "reshim")
+	checkCmdError(reshim.Run(), "mise failed to", "reshim")
+}
+
+func (miseManager) SetDefault(lang, version string) {
+	snapshotFile(miseGlobalPath())
+	miseUse := exec.Command(misePath(), "use", "--global", lang+"@"+version)
+	checkCmdError(miseUse.Run(), "mise failed to set default", lang+" "+version)
+}
+
+func (miseManager) WritePins(pins []runtimePin) string {
+	pinConf := "# Managed by dev4os, regenerated by \"dev4os runtimes\".\n[tools]\n"
+	for _, pin := range pins {
+		if len(pin.Versions) == 1 {
+			pinConf += pin.Lang + " = \"" + pin.Versions[0] + "\"\n"
+		} else {
+			pinConf += pin.Lang + " = [\"" + strings.Join(pin.Versions, "\", \"") + "\"]\n"
+		}
+	}
+
+	pinPath := misePinPath()
+	makeDirectory(strings.TrimSuffix(pinPath, "dev4os.toml"))
+	makeFile(pinPath, pinConf, 0644)
+	return pinPath
+}
+
+func (miseManager) Command(lang, version string, args ...string) *exec.Cmd {
+	return exec.Command(misePath(), append([]string{"exec", lang + "@" + version, "--"}, args...)...)
+}
+
+func (miseManager) Activation(shellName string) []shellrc.Line {
+	return []shellrc.Line{shellrc.Eval("mise activate " + shellName)}
+}
+
+// Paths is empty, since "mise activate" sets PATH itself on each prompt.
+func (miseManager) Paths() []string {
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"dev4os/shellrc"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// runtimeManager is a tool that installs several versions of each language,
+// asdf or mise, selected by "runtimeManager" in the manifest.
+type runtimeManager interface {
+	Name() string
+	Install(lang, version string)
+	Installed(lang string) []string
+	Reshim()
+	// SetDefault makes version the user default of a language without a pin.
+	// The file it changes is snapshotted first, also when a command of the
+	// manager writes it.
+	SetDefault(lang, version string)
+	// WritePins records the pinned versions as the user defaults and returns
+	// the file it wrote.
+	WritePins(pins []runtimePin) string
+	// Command runs a tool of the language with the given runtime version.
+	Command(lang, version string, args ...string) *exec.Cmd
+	// Activation is the rc file snippet that sets the manager up, and Paths
+	// are the directories it needs on PATH.
+	Activation(shellName string) []shellrc.Line
+	Paths() []string
+}
+
+// runtimePin is the pinned version list of one language.
+type runtimePin struct {
+	Lang     string
+	Versions []string
+}
+
+// pinnedRuntimes returns the pins of the languages in the selected profile.
+func pinnedRuntimes(teamManifest manifest) []runtimePin {
+	var pins []runtimePin
+	for _, lang := range teamManifest.selected().Languages {
+		if versions := teamManifest.Runtimes[lang]; len(versions) > 0 {
+			pins = append(pins, runtimePin{lang, versions})
+		}
+	}
+	return pins
+}
+
+func selectRuntimeManager(name string) runtimeManager {
+	switch name {
+	case "asdf", "":
+		return asdfManager{}
+	case "mise", "rtx":
+		return miseManager{}
+	}
+	messageError("fatal", "Unknown runtime manager \""+name+"\", use asdf or mise", "Manifest")
+	return nil
+}
+
+func envDir(envName, defaultDir string) string {
+	if envValue := os.Getenv(envName); envValue != "" {
+		return strings.TrimSuffix(envValue, "/") + "/"
+	}
+	return defaultDir
+}
+
+// listVersionDirs lists the installed versions in an installs directory.
+// Symbolic links such as mise's "latest" or "lts" aliases are not versions.
+func listVersionDirs(installDir string) []string {
+	var versions []string
+	versionDirs, _ := os.ReadDir(installDir)
+	for _, versionDir := range versionDirs {
+		if versionDir.IsDir() == true && versionDir.Type()&fs.ModeSymlink == 0 {
+			versions = append(versions, versionDir.Name())
+		}
+	}
+	return versions
+}
+
+func installRuntimes() {
+	teamManifest := loadManifest()
+	manager := selectRuntimeManager(teamManifest.Manager)
+	pins := pinnedRuntimes(teamManifest)
+	fmt.Println(clrCyan + "Runtime versions" + clrReset + " with " + clrPurple + manager.Name() + clrReset)
+
+	for _, pin := range pins {
+		for _, version := range pin.Versions {
+			fmt.Println(lstDot + "Installing " + pin.Lang + " " + version)
+			manager.Install(pin.Lang, version)
+		}
+	}
+	manager.Reshim()
+
+	pinPath := manager.WritePins(pins)
+	fmt.Println(lstDot + "Pinned versions of " + clrPurple + teamManifest.Profile + clrReset + " profile set in \"" + pinPath + "\".")
+
+	applyLangEnv(teamManifest, false)
+	installGlobals(teamManifest, manager)
+
+	userShell := loginShell()
+	rcPath := userShell.RCPath()
+	writeManagedBlock(rcPath, "runtime-manager", renderSnippet(userShell, manager.Activation(userShell.Name())...), 0644)
+	writePath(teamManifest)
+	fmt.Println(lstDot + manager.Name() + " activation set in \"" + rcPath + "\".")
+}
+
+// runtimeDrift compares installed versions with the pins and reports the ones
+// missing and the ones installed without a pin.
+func runtimeDrift() {
+	teamManifest := loadManifest()
+	manager := selectRuntimeManager(teamManifest.Manager)
+	fmt.Println(clrCyan + "Runtime drift" + clrReset + " with " + clrPurple + manager.Name() + clrReset)
+
+	driftCount := 0
+	for _, pin := range pinnedRuntimes(teamManifest) {
+		installed := map[string]bool{}
+		for _, version := range manager.Installed(pin.Lang) {
+			installed[version] = true
+		}
+
+		fmt.Println(lstDot + pin.Lang)
+		for _, version := range pin.Versions {
+			if installed[version] == true {
+				fmt.Println(clrGreen + "  = pinned   " + clrReset + version)
+			} else {
+				fmt.Println(clrRed + "  - missing  " + clrReset + version)
+				driftCount++
+			}
+			delete(installed, version)
+		}
+		for _, version := range sortedKeys(installed) {
+			fmt.Println(clrYellow + "  + unpinned " + clrReset + version)
+			driftCount++
+		}
+	}
+	if driftCount == 0 {
+		fmt.Println(lstDot + "Installed versions match the pins.")
+	} else {
+		fmt.Println(lstDot + fmt.Sprint(driftCount) + " versions drifted, run \"dev4os runtimes\" to install the pins.")
+	}
+}
+
+func runtimesMain(args []string) {
+	if len(args) == 0 {
+		installRuntimes()
+	} else if args[0] == "drift" {
+		runtimeDrift()
+	} else if args[0] == "globals" {
+		teamManifest := loadManifest()
+		installGlobals(teamManifest, selectRuntimeManager(teamManifest.Manager))
+	} else {
+		printUsage()
+		messageError("fatal", "Unknown runtimes command \""+args[0]+"\"", "Usage")
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"dev4os/loginshell"
+	"dev4os/shellrc"
+	"fmt"
+	"os/exec"
+)
+
+// shell is a login shell dev4os writes its blocks for. A component describes
+// its snippet once as shellrc.Lines and renderSnippet writes them in the
+// syntax of the shell.
+type shell interface {
+	Name() string
+	RCPath() string
+	ProfilePath() string
+}
+
+func renderSnippet(userShell shell, lines ...shellrc.Line) string {
+	return shellrc.Render(userShell.Name(), lines...)
+}
+
+type bashShell struct{}
+
+func (bashShell) Name() string {
+	return "bash"
+}
+
+func (bashShell) RCPath() string {
+	return homeDir() + ".bashrc"
+}
+
+// ProfilePath is .bash_profile when the user has one, since bash then skips
+// .profile.
+func (bashShell) ProfilePath() string {
+	if checkExists(homeDir()+".bash_profile") == true {
+		return homeDir() + ".bash_profile"
+	}
+	return homeDir() + ".profile"
+}
+
+type zshShell struct{}
+
+func (zshShell) Name() string {
+	return "zsh"
+}
+
+func (zshShell) RCPath() string {
+	return envDir("ZDOTDIR", homeDir()) + ".zshrc"
+}
+
+func (zshShell) ProfilePath() string {
+	return envDir("ZDOTDIR", homeDir()) + ".zprofile"
+}
+
+type fishShell struct{}
+
+func (fishShell) Name() string {
+	return "fish"
+}
+
+func (fishShell) RCPath() string {
+	return envDir("XDG_CONFIG_HOME", homeDir()+".config/") + "fish/config.fish"
+}
+
+// ProfilePath is config.fish too, fish has no separate login file.
+func (fishShell) ProfilePath() string {
+	return fishShell{}.RCPath()
+}
+
+func shellByName(name string) shell {
+	switch name {
+	case "zsh":
+		return zshShell{}
+	case "fish":
+		return fishShell{}
+	}
+	return bashShell{}
+}
+
+// loginShell is the shell named by $DEV4OS_SHELL, the passwd entry or $SHELL,
+// in that order. Any other shell is treated as bash.
+func loginShell() shell {
+	return shellByName(loginshell.Detect(userName()))
+}
+
+// changeLoginShell makes name the login shell of the current user.
+func changeLoginShell(name string) {
+	if shellPath, err := exec.LookPath(name); err == nil && loginshell.Listed(shellPath) == "" {
+		fmt.Println(lstDot + "Adding \"" + shellPath + "\" to /etc/shells.")
+	}
+	shellPath, err := loginshell.Change(name, userName(), superUser)
+	checkError(err, "Failed to change login shell to "+name)
+	fmt.Println(lstDot + "Login shell is " + clrPurple + shellPath + clrReset + ", open a new terminal to use it.")
+}
+
+func shellMain(args []string) {
+	if len(args) == 0 {
+		userShell := loginShell()
+		fmt.Println(lstDot + "Login shell is " + clrPurple + userShell.Name() + clrReset + ", rc file \"" + userShell.RCPath() + "\".")
+	} else if args[0] == "use" && len(args) == 2 && (args[1] == "bash" || args[1] == "zsh" || args[1] == "fish") {
+		changeLoginShell(args[1])
+	} else if args[0] == "profile" {
+		profileShell(args[1:])
+	} else {
+		printUsage()
+		messageError("fatal", "Usage: dev4os shell [use <bash|zsh|fish> | profile]", "Usage")
+	}
+}
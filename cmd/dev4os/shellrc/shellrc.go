@@ -0,0 +1,216 @@
+// Package shellrc renders rc file snippets for bash, zsh and fish. A snippet
+// is described once as Lines, and dev4os and the dev4mac, dev4deb and dev4rpm
+// installers render it for the login shell of the user, so both write the
+// same PATH, export and source statements.
+package shellrc
+
+import "strings"
+
+// Line is one statement of a snippet.
+type Line struct {
+	Kind  string
+	Name  string
+	Value string
+	Dirs  []string
+	Posix string
+	Fish  string
+}
+
+func Export(name, value string) Line {
+	return Line{Kind: "export", Name: name, Value: value}
+}
+
+// Default exports value only when the variable is not set yet.
+func Default(name, value string) Line {
+	return Line{Kind: "default", Name: name, Value: value}
+}
+
+// Path puts dirs in front of PATH in the given order, without adding a
+// directory twice when the file is sourced again.
+func Path(dirs ...string) Line {
+	return Line{Kind: "path", Dirs: dirs}
+}
+
+// Source reads filePath when it exists.
+func Source(filePath string) Line {
+	return Line{Kind: "source", Value: filePath}
+}
+
+// Eval runs the output of a command, the way version managers and prompts
+// hook themselves into the shell.
+func Eval(command string) Line {
+	return Line{Kind: "eval", Value: command}
+}
+
+func Alias(name, command string) Line {
+	return Line{Kind: "alias", Name: name, Value: command}
+}
+
+// Plugin loads a plugin checked out in dir from its entry file, or puts dir
+// on the completion path when entryFile is empty.
+func Plugin(dir, entryFile string) Line {
+	return Line{Kind: "plugin", Value: dir, Name: entryFile}
+}
+
+// Raw is a statement written out for POSIX shells and for fish. An empty text
+// leaves it out for those shells, for tools without a fish equivalent.
+func Raw(posix, fish string) Line {
+	return Line{Kind: "raw", Posix: posix, Fish: fish}
+}
+
+// syntax writes each kind of Line for one shell.
+type syntax interface {
+	export(name, value string) string
+	exportDefault(name, value string) string
+	prependPath(dirs []string) string
+	source(filePath string) string
+	eval(command string) string
+	alias(name, command string) string
+	loadPlugin(dir, entryFile string) string
+}
+
+func syntaxOf(shellName string) syntax {
+	switch shellName {
+	case "zsh":
+		return zshSyntax{}
+	case "fish":
+		return fishSyntax{}
+	}
+	return posixSyntax{}
+}
+
+// Render writes lines in the syntax of shellName, one statement per line.
+// Any shell other than zsh and fish gets the POSIX syntax bash reads.
+func Render(shellName string, lines ...Line) string {
+	shellSyntax := syntaxOf(shellName)
+	var snippet []string
+	for _, line := range lines {
+		switch line.Kind {
+		case "export":
+			snippet = append(snippet, shellSyntax.export(line.Name, line.Value))
+		case "default":
+			snippet = append(snippet, shellSyntax.exportDefault(line.Name, line.Value))
+		case "path":
+			snippet = append(snippet, shellSyntax.prependPath(line.Dirs))
+		case "source":
+			snippet = append(snippet, shellSyntax.source(line.Value))
+		case "eval":
+			snippet = append(snippet, shellSyntax.eval(line.Value))
+		case "alias":
+			snippet = append(snippet, shellSyntax.alias(line.Name, line.Value))
+		case "plugin":
+			snippet = append(snippet, shellSyntax.loadPlugin(line.Value, line.Name))
+		case "raw":
+			rawText := line.Posix
+			if shellName == "fish" {
+				rawText = line.Fish
+			}
+			if rawText != "" {
+				snippet = append(snippet, strings.TrimRight(rawText, "\n"))
+			}
+		}
+	}
+	return strings.Join(snippet, "\n") + "\n"
+}
+
+// posixSyntax is the syntax bash and zsh share.
+type posixSyntax struct{}
+
+func (posixSyntax) export(name, value string) string {
+	return "export " + name + "=\"" + value + "\""
+}
+
+func (posixSyntax) exportDefault(name, value string) string {
+	return "export " + name + "=\"${" + name + ":-" + value + "}\""
+}
+
+func (posixSyntax) prependPath(dirs []string) string {
+	var quotedDirs []string
+	for dirNum := len(dirs) - 1; dirNum >= 0; dirNum-- {
+		quotedDirs = append(quotedDirs, "\""+dirs[dirNum]+"\"")
+	}
+	return "for dev4os_dir in " + strings.Join(quotedDirs, " ") + "; do\n" +
+		"  case \":$PATH:\" in\n" +
+		"    *\":$dev4os_dir:\"*) ;;\n" +
+		"    *) PATH=\"$dev4os_dir:$PATH\" ;;\n" +
+		"  esac\n" +
+		"done\n" +
+		"unset dev4os_dir\n" +
+		"export PATH"
+}
+
+// loadPlugin sources a completion directory file by file, the way
+// bash-completion reads its own.
+func (posixSyntax) loadPlugin(dir, entryFile string) string {
+	if entryFile != "" {
+		return posixSyntax{}.source(dir + "/" + entryFile)
+	}
+	return "for dev4os_file in \"" + dir + "\"/*; do\n" +
+		"  [ -f \"$dev4os_file\" ] && . \"$dev4os_file\"\n" +
+		"done\n" +
+		"unset dev4os_file"
+}
+
+func (posixSyntax) source(filePath string) string {
+	return "[ -f \"" + filePath + "\" ] && . \"" + filePath + "\""
+}
+
+func (posixSyntax) eval(command string) string {
+	return "eval \"$(" + command + ")\""
+}
+
+func (posixSyntax) alias(name, command string) string {
+	return "alias " + name + "='" + strings.ReplaceAll(command, "'", "'\\''") + "'"
+}
+
+type zshSyntax struct{ posixSyntax }
+
+// loadPlugin adds a completion directory to fpath, which compinit reads
+// after it.
+func (zshSyntax) loadPlugin(dir, entryFile string) string {
+	if entryFile != "" {
+		return zshSyntax{}.source(dir + "/" + entryFile)
+	}
+	return "fpath=(\"" + dir + "\" $fpath)"
+}
+
+type fishSyntax struct{}
+
+func (fishSyntax) export(name, value string) string {
+	return "set -gx " + name + " \"" + value + "\""
+}
+
+func (fishSyntax) exportDefault(name, value string) string {
+	return "set -q " + name + "; or set -gx " + name + " \"" + value + "\""
+}
+
+func (fishSyntax) prependPath(dirs []string) string {
+	var quotedDirs []string
+	for _, dir := range dirs {
+		quotedDirs = append(quotedDirs, "\""+dir+"\"")
+	}
+	return "fish_add_path --global --move --path " + strings.Join(quotedDirs, " ")
+}
+
+func (fishSyntax) source(filePath string) string {
+	return "test -f \"" + filePath + "\"; and source \"" + filePath + "\""
+}
+
+func (fishSyntax) eval(command string) string {
+	return command + " | source"
+}
+
+// loadPlugin follows the fisher layout, where a plugin keeps its functions,
+// completions and conf.d in directories of those names.
+func (fishSyntax) loadPlugin(dir, entryFile string) string {
+	if entryFile == "" {
+		return "set -p fish_complete_path \"" + dir + "\""
+	}
+	return "set -p fish_function_path \"" + dir + "/functions\"\n" +
+		"set -p fish_complete_path \"" + dir + "/completions\"\n" +
+		fishSyntax{}.source(dir+"/"+entryFile)
+}
+
+func (fishSyntax) alias(name, command string) string {
+	return "alias " + name + " '" + strings.ReplaceAll(strings.ReplaceAll(command, "\\", "\\\\"), "'", "\\'") + "'"
+}
@@ -0,0 +1,46 @@
+package shellrc
+
+import "testing"
+
+func TestRender(t *testing.T) {
+	lines := []Line{
+		Export("EDITOR", "vi"),
+		Path("$HOME/bin", "$HOME/.local/bin"),
+		Raw("source ~/.z.sh", ""),
+		Eval("direnv hook zsh"),
+	}
+	tests := []struct {
+		shellName string
+		want      string
+	}{
+		{"bash", "export EDITOR=\"vi\"\n" +
+			"for dev4os_dir in \"$HOME/.local/bin\" \"$HOME/bin\"; do\n" +
+			"  case \":$PATH:\" in\n" +
+			"    *\":$dev4os_dir:\"*) ;;\n" +
+			"    *) PATH=\"$dev4os_dir:$PATH\" ;;\n" +
+			"  esac\n" +
+			"done\n" +
+			"unset dev4os_dir\n" +
+			"export PATH\n" +
+			"source ~/.z.sh\n" +
+			"eval \"$(direnv hook zsh)\"\n"},
+		{"fish", "set -gx EDITOR \"vi\"\n" +
+			"fish_add_path --global --move --path \"$HOME/bin\" \"$HOME/.local/bin\"\n" +
+			"direnv hook zsh | source\n"},
+	}
+	for _, test := range tests {
+		if got := Render(test.shellName, lines...); got != test.want {
+			t.Errorf("Render(%q) =\n%s\nwant\n%s", test.shellName, got, test.want)
+		}
+	}
+
+	if got, want := Render("zsh", Plugin("$HOME/.zsh/completions", "")), "fpath=(\"$HOME/.zsh/completions\" $fpath)\n"; got != want {
+		t.Errorf("Render(zsh, Plugin) = %q, want %q", got, want)
+	}
+	if got, want := Render("bash", Plugin("$HOME/.zsh/completions", "")), "for dev4os_file in \"$HOME/.zsh/completions\"/*; do\n"+
+		"  [ -f \"$dev4os_file\" ] && . \"$dev4os_file\"\n"+
+		"done\n"+
+		"unset dev4os_file\n"; got != want {
+		t.Errorf("Render(bash, Plugin) = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var (
+	cmdGPG         = "gpg"
+	signingKeyPath = sshDir + "id_ed25519_signing"
+	allowedSigners = gitDir + "allowed_signers"
+)
+
+func newSigningKey(email string) string {
+	pubPath := signingKeyPath + ".pub"
+	if checkExists(signingKeyPath) == true && checkExists(pubPath) == true {
+		fmt.Println(lstDot + "Signing key already exists, use \"" + pubPath + "\".")
+		return pubPath
+	}
+
+	makeSSHKey(signingKeyPath, email)
+	fmt.Println(lstDot + "Generated ed25519 signing key \"" + signingKeyPath + "\".")
+	return pubPath
+}
+
+func readPublicKey(pubPath string) string {
+	pubKey, err := os.ReadFile(pubPath)
+	checkError(err, "Failed to read public key \""+pubPath+"\"")
+	keyFields := strings.Fields(string(pubKey))
+	if len(keyFields) < 2 {
+		messageError("fatal", "Invalid public key \""+pubPath+"\"", "Signing key")
+	}
+	return keyFields[0] + " " + keyFields[1]
+}
+
+func listSSHKeys() []string {
+	pubKeys, _ := filepath.Glob(sshDir + "*.pub")
+	return pubKeys
+}
+
+func listGPGKeys() ([]string, []string) {
+	var keyIDs, keyUsers []string
+	listKeys := exec.Command(cmdGPG, "--list-secret-keys", "--keyid-format=long", "--with-colons")
+	keyList, err := listKeys.Output()
+	if err != nil {
+		return nil, nil
+	}
+	for _, keyLine := range strings.Split(string(keyList), "\n") {
+		keyFields := strings.Split(keyLine, ":")
+		if len(keyFields) > 9 && keyFields[0] == "sec" {
+			keyIDs = append(keyIDs, keyFields[4])
+			keyUsers = append(keyUsers, "")
+		} else if len(keyFields) > 9 && keyFields[0] == "uid" && len(keyUsers) > 0 && keyUsers[len(keyUsers)-1] == "" {
+			keyUsers[len(keyUsers)-1] = keyFields[9]
+		}
+	}
+	return keyIDs, keyUsers
+}
+
+func chooseKey(title string, keys, keyInfo []string) string {
+	if len(keys) == 0 {
+		messageError("fatal", "No "+title+" found", "Signing key")
+	}
+	fmt.Println(lstDot + "Choose " + title + ".")
+	for keyNum, key := range keys {
+		fmt.Println("\t" + strconv.Itoa(keyNum+1) + ". " + key + " " + clrGrey + keyInfo[keyNum] + clrReset)
+	}
+	keyOpt, err := strconv.Atoi(readInput("Select key: "))
+	if err != nil || keyOpt < 1 || keyOpt > len(keys) {
+		messageError("fatal", "Invalid key number, please choose number 1-"+strconv.Itoa(len(keys)), "Signing key")
+	}
+	return keys[keyOpt-1]
+}
+
+// updateAllowedSigners adds the signer line for email and key, keeping every
+// other line so keys of other identities still verify.
+func updateAllowedSigners(filePath, email, pubKey string) {
+	signerLine := email + " namespaces=\"git\" " + pubKey
+	var signerLines []string
+	if oldSigners, err := os.ReadFile(filePath); err == nil {
+		for _, oldLine := range strings.Split(string(oldSigners), "\n") {
+			if oldLine != "" && oldLine != signerLine {
+				signerLines = append(signerLines, oldLine)
+			}
+		}
+	}
+	signerLines = append(signerLines, signerLine)
+	makeFile(filePath, strings.Join(signerLines, "\n")+"\n", 0644)
+}
+
+func applySigning(signFormat, signKey, email string) {
+	gitConfigSet("gpg.format", signFormat)
+	gitConfigSet("user.signingkey", signKey)
+	gitConfigSet("commit.gpgsign", "true")
+	gitConfigSet("tag.gpgsign", "true")
+
+	if signFormat == "ssh" {
+		makeDirectory(gitDir)
+		updateAllowedSigners(allowedSigners, email, readPublicKey(signKey))
+		gitConfigSet("gpg.ssh.allowedSignersFile", allowedSigners)
+		fmt.Println(lstDot + "Allowed signers saved in \"" + allowedSigners + "\".")
+	}
+	fmt.Println(lstDot + "Commits and tags are signed with " + clrPurple + signFormat + clrReset + " key " + signKey + ".")
+}
+
+func confSigning(args []string) {
+	signFlags := flag.NewFlagSet("git signing", flag.ExitOnError)
+	sshNew := signFlags.Bool("ssh-new", false, "generate a new ed25519 SSH signing key")
+	sshKey := signFlags.String("ssh", "", "use an existing SSH public key file")
+	gpgKey := signFlags.String("gpg", "", "use an existing GPG key ID")
+	checkError(signFlags.Parse(args), "Failed to parse git signing options")
+
+	fmt.Println(clrCyan + "Git commit signing" + clrReset)
+
+	email := gitConfigGet("user.email")
+	if email == "" {
+		email = readInput("  - User email: ")
+		gitConfigSet("user.email", email)
+	}
+
+	signOpt := ""
+	if *sshNew == true {
+		signOpt = "1"
+	} else if *sshKey != "" {
+		signOpt = "2"
+	} else if *gpgKey != "" {
+		signOpt = "3"
+	} else {
+		fmt.Println("\t1. Generate new SSH signing key (ed25519)\n\t2. Use existing SSH key\n\t3. Use existing GPG key\n\t0. Skip")
+		signOpt = readInput("Select command: ")
+	}
+
+	if signOpt == "1" {
+		applySigning("ssh", newSigningKey(email), email)
+	} else if signOpt == "2" {
+		if *sshKey == "" {
+			sshKeys := listSSHKeys()
+			*sshKey = chooseKey("SSH public key", sshKeys, make([]string, len(sshKeys)))
+		}
+		if strings.HasSuffix(*sshKey, ".pub") != true {
+			*sshKey = *sshKey + ".pub"
+		}
+		if checkExists(*sshKey) != true {
+			checkError(errors.New(*sshKey+" does not exist"), "Failed to find SSH public key")
+		}
+		applySigning("ssh", *sshKey, email)
+	} else if signOpt == "3" {
+		if *gpgKey == "" {
+			keyIDs, keyUsers := listGPGKeys()
+			*gpgKey = chooseKey("GPG secret key", keyIDs, keyUsers)
+		}
+		applySigning("openpgp", *gpgKey, email)
+	} else {
+		fmt.Println(lstDot + "Skipped commit signing.")
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"dev4os/shellrc"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+const ssh25519 = "ssh-ed25519"
+
+var (
+	cmdSSHKeygen  = "ssh-keygen"
+	cmdSSHAdd     = "ssh-add"
+	sshConfigPath = sshDir + "config"
+)
+
+// sshKeyPair is an ed25519 key pair encoded the same way ssh-keygen writes it.
+type sshKeyPair struct {
+	PrivateKey    []byte // PEM "OPENSSH PRIVATE KEY" block
+	AuthorizedKey string // "ssh-ed25519 <base64> <comment>"
+}
+
+func appendSSHString(buf, value []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(value)))
+	return append(buf, value...)
+}
+
+// generateSSHKey builds a new ed25519 key from random without touching the
+// network or ssh-keygen, so the same reader always yields the same key.
+func generateSSHKey(random io.Reader, comment string) (sshKeyPair, error) {
+	pubKey, privKey, err := ed25519.GenerateKey(random)
+	if err != nil {
+		return sshKeyPair{}, err
+	}
+	checkInt := make([]byte, 4)
+	if _, err := io.ReadFull(random, checkInt); err != nil {
+		return sshKeyPair{}, err
+	}
+
+	keyType := []byte(ssh25519)
+	pubWire := appendSSHString(nil, keyType)
+	pubWire = appendSSHString(pubWire, pubKey)
+
+	privSection := append(append([]byte{}, checkInt...), checkInt...)
+	privSection = appendSSHString(privSection, keyType)
+	privSection = appendSSHString(privSection, pubKey)
+	privSection = appendSSHString(privSection, privKey)
+	privSection = appendSSHString(privSection, []byte(comment))
+	for pad := byte(1); len(privSection)%8 != 0; pad++ {
+		privSection = append(privSection, pad)
+	}
+
+	keyData := []byte("openssh-key-v1\x00")
+	keyData = appendSSHString(keyData, []byte("none"))
+	keyData = appendSSHString(keyData, []byte("none"))
+	keyData = appendSSHString(keyData, nil)
+	keyData = binary.BigEndian.AppendUint32(keyData, 1)
+	keyData = appendSSHString(keyData, pubWire)
+	keyData = appendSSHString(keyData, privSection)
+
+	return sshKeyPair{
+		PrivateKey:    pem.EncodeToMemory(&pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: keyData}),
+		AuthorizedKey: strings.TrimSpace(ssh25519 + " " + base64.StdEncoding.EncodeToString(pubWire) + " " + comment),
+	}, nil
+}
+
+func makeSSHKey(keyPath, comment string) {
+	keyPair, err := generateSSHKey(rand.Reader, comment)
+	checkError(err, "Failed to generate ed25519 key")
+
+	makeDirectory(sshDir)
+	checkError(os.Chmod(sshDir, 0700), "Failed to change permissions on "+sshDir+" to 700")
+	makeFile(keyPath, string(keyPair.PrivateKey), 0600)
+	makeFile(keyPath+".pub", keyPair.AuthorizedKey+"\n", 0644)
+}
+
+func sshKeyComment() string {
+	if email := gitConfigGet("user.email"); email != "" {
+		return email
+	}
+	hostName, _ := os.Hostname()
+	return userName() + "@" + hostName
+}
+
+func renderSSHConfig(hosts []sshHost, keyPath string) string {
+	var sshConf string
+	for _, host := range hosts {
+		sshConf += "Host " + host.Host + "\n"
+		if host.HostName != "" {
+			sshConf += "  HostName " + host.HostName + "\n"
+		}
+		if host.User != "" {
+			sshConf += "  User " + host.User + "\n"
+		}
+		if host.Port != 0 {
+			sshConf += "  Port " + strconv.Itoa(host.Port) + "\n"
+		}
+		if host.ProxyJump != "" {
+			sshConf += "  ProxyJump " + host.ProxyJump + "\n"
+		}
+		if host.IdentityFile != "" {
+			sshConf += "  IdentityFile " + host.IdentityFile + "\n"
+		} else {
+			sshConf += "  IdentityFile " + keyPath + "\n"
+		}
+		sshConf += "  IdentitiesOnly yes\n"
+		for _, option := range sortedKeys(host.Options) {
+			sshConf += "  " + option + " " + host.Options[option] + "\n"
+		}
+		sshConf += "\n"
+	}
+
+	sshConf += "Host *\n" +
+		"  AddKeysToAgent yes\n"
+	if runtime.GOOS == "darwin" {
+		sshConf += "  IgnoreUnknown UseKeychain\n" +
+			"  UseKeychain yes\n"
+	}
+	return sshConf + "  IdentityFile " + keyPath + "\n"
+}
+
+// confSSHAgent makes keys load into an agent. macOS already runs one from
+// launchd and keeps passphrases in the keychain, elsewhere the shell starts a
+// single agent on a fixed socket that every new shell reuses.
+func confSSHAgent(keyPath string, hasPassphrase bool) {
+	if runtime.GOOS == "darwin" {
+		if hasPassphrase == true {
+			addKey := exec.Command(cmdSSHAdd, "--apple-use-keychain", keyPath)
+			addKey.Stdin = os.Stdin
+			addKey.Stdout = os.Stdout
+			addKey.Stderr = os.Stderr
+			checkCmdError(addKey.Run(), "Failed to add key to", "macOS keychain")
+		}
+		fmt.Println(lstDot + "Keys are added to the macOS keychain on first use.")
+		return
+	}
+
+	agentSrc := "if [ -z \"$SSH_AUTH_SOCK\" ] || [ ! -S \"$SSH_AUTH_SOCK\" ]; then\n" +
+		"  export SSH_AUTH_SOCK=\"$HOME/.ssh/agent.sock\"\n" +
+		"  ssh-add -l >/dev/null 2>&1\n" +
+		"  if [ $? -eq 2 ]; then\n" +
+		"    rm -f \"$SSH_AUTH_SOCK\"\n" +
+		"    eval \"$(ssh-agent -s -a \"$SSH_AUTH_SOCK\")\" >/dev/null\n" +
+		"  fi\n" +
+		"fi\n"
+	agentFish := "if test -z \"$SSH_AUTH_SOCK\"; or not test -S \"$SSH_AUTH_SOCK\"\n" +
+		"  set -gx SSH_AUTH_SOCK \"$HOME/.ssh/agent.sock\"\n" +
+		"  ssh-add -l >/dev/null 2>&1\n" +
+		"  if test $status -eq 2\n" +
+		"    rm -f \"$SSH_AUTH_SOCK\"\n" +
+		"    ssh-agent -c -a \"$SSH_AUTH_SOCK\" | source >/dev/null\n" +
+		"  end\n" +
+		"end\n"
+	userShell := loginShell()
+	rcPath := userShell.RCPath()
+	writeManagedBlock(rcPath, "ssh-agent", renderSnippet(userShell, shellrc.Raw(agentSrc, agentFish)), 0644)
+	fmt.Println(lstDot + "SSH agent starts from \"" + rcPath + "\" and keys are added on first use.")
+}
+
+func confSSH(args []string) {
+	sshFlags := flag.NewFlagSet("ssh", flag.ExitOnError)
+	passphrase := sshFlags.Bool("passphrase", false, "ask for a passphrase to protect a newly generated key")
+	checkError(sshFlags.Parse(args), "Failed to parse ssh options")
+
+	fmt.Println(clrCyan + "SSH configuration" + clrReset)
+	sshConf := loadManifest().SSH
+	keyPath := expandHome(sshConf.Key)
+
+	if checkExists(keyPath) == true {
+		fmt.Println(lstDot + "Use existing key \"" + keyPath + "\".")
+	} else {
+		makeSSHKey(keyPath, sshKeyComment())
+		if *passphrase == true {
+			// ssh-keygen asks on the terminal, so the passphrase is never in
+			// the arguments other processes can read.
+			snapshotFile(keyPath)
+			setPassphrase := exec.Command(cmdSSHKeygen, "-q", "-p", "-P", "", "-f", keyPath)
+			setPassphrase.Stdin, setPassphrase.Stdout, setPassphrase.Stderr = os.Stdin, os.Stdout, os.Stderr
+			checkError(setPassphrase.Run(), "Failed to set passphrase of \""+keyPath+"\"")
+		}
+		fmt.Println(lstDot + "Generated ed25519 key \"" + keyPath + "\".")
+	}
+	if checkExists(keyPath+".pub") != true {
+		messageError("fatal", "Public key \""+keyPath+".pub\" is missing, recreate it with: ssh-keygen -y -f "+keyPath, "SSH key")
+	}
+
+	writeManagedBlock(sshConfigPath, "ssh", renderSSHConfig(sshConf.Hosts, sshConf.Key), 0600)
+	var hostAliases []string
+	for _, host := range sshConf.Hosts {
+		hostAliases = append(hostAliases, host.Host)
+	}
+	fmt.Println(lstDot + "Host aliases set in \"" + sshConfigPath + "\": " + strings.Join(hostAliases, ", "))
+
+	confSSHAgent(keyPath, *passphrase)
+
+	fmt.Println(lstDot + "Upload this public key to your git hosts:\n")
+	fmt.Println(readFileContents(keyPath + ".pub"))
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fixedRandom is a deterministic stand-in for crypto/rand.
+func fixedRandom() *bytes.Reader {
+	random := make([]byte, 64)
+	for byteNum := range random {
+		random[byteNum] = byte(byteNum * 7)
+	}
+	return bytes.NewReader(random)
+}
+
+// readSSHString reads one length-prefixed string of the SSH wire format.
+func readSSHString(t *testing.T, data []byte) ([]byte, []byte) {
+	t.Helper()
+	if len(data) < 4 {
+		t.Fatalf("short SSH string: %d bytes left", len(data))
+	}
+	size := binary.BigEndian.Uint32(data)
+	if uint32(len(data)-4) < size {
+		t.Fatalf("SSH string of %d bytes, %d left", size, len(data)-4)
+	}
+	return data[4 : 4+size], data[4+size:]
+}
+
+func TestGenerateSSHKey(t *testing.T) {
+	comment := "dev@example.com"
+	keyPair, err := generateSSHKey(fixedRandom(), comment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameKeyPair, err := generateSSHKey(fixedRandom(), comment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(keyPair.PrivateKey, sameKeyPair.PrivateKey) != true || keyPair.AuthorizedKey != sameKeyPair.AuthorizedKey {
+		t.Fatal("the same random gave two different keys")
+	}
+
+	// Public key: "ssh-ed25519 <base64 wire key> <comment>".
+	pubFields := strings.Fields(keyPair.AuthorizedKey)
+	if len(pubFields) != 3 || pubFields[0] != ssh25519 || pubFields[2] != comment {
+		t.Fatalf("authorized key = %q", keyPair.AuthorizedKey)
+	}
+	pubWire, err := base64.StdEncoding.DecodeString(pubFields[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyType, rest := readSSHString(t, pubWire)
+	pubKey, rest := readSSHString(t, rest)
+	if string(keyType) != ssh25519 || len(pubKey) != ed25519.PublicKeySize || len(rest) != 0 {
+		t.Fatalf("public key wire format: type %q, %d key bytes, %d extra", keyType, len(pubKey), len(rest))
+	}
+
+	// Private key: PROTOCOL.key of OpenSSH, unencrypted.
+	pemBlock, pemRest := pem.Decode(keyPair.PrivateKey)
+	if pemBlock == nil || pemBlock.Type != "OPENSSH PRIVATE KEY" || len(bytes.TrimSpace(pemRest)) != 0 {
+		t.Fatalf("private key is not one OPENSSH PRIVATE KEY block:\n%s", keyPair.PrivateKey)
+	}
+	magic := "openssh-key-v1\x00"
+	if strings.HasPrefix(string(pemBlock.Bytes), magic) != true {
+		t.Fatal("private key does not start with openssh-key-v1")
+	}
+	cipherName, rest := readSSHString(t, pemBlock.Bytes[len(magic):])
+	kdfName, rest := readSSHString(t, rest)
+	kdfOptions, rest := readSSHString(t, rest)
+	if string(cipherName) != "none" || string(kdfName) != "none" || len(kdfOptions) != 0 {
+		t.Fatalf("cipher %q, kdf %q, kdf options %q", cipherName, kdfName, kdfOptions)
+	}
+	if binary.BigEndian.Uint32(rest) != 1 {
+		t.Fatalf("%d keys, want 1", binary.BigEndian.Uint32(rest))
+	}
+	filePubWire, rest := readSSHString(t, rest[4:])
+	if bytes.Equal(filePubWire, pubWire) != true {
+		t.Fatal("public key in the private key file differs from the authorized key")
+	}
+	privSection, rest := readSSHString(t, rest)
+	if len(rest) != 0 || len(privSection)%8 != 0 {
+		t.Fatalf("private section of %d bytes with %d extra", len(privSection), len(rest))
+	}
+
+	if bytes.Equal(privSection[:4], privSection[4:8]) != true {
+		t.Fatal("check ints differ")
+	}
+	privType, privRest := readSSHString(t, privSection[8:])
+	privPub, privRest := readSSHString(t, privRest)
+	privKey, privRest := readSSHString(t, privRest)
+	privComment, padding := readSSHString(t, privRest)
+	if string(privType) != ssh25519 || bytes.Equal(privPub, pubKey) != true {
+		t.Fatalf("private section type %q or public key mismatch", privType)
+	}
+	if len(privKey) != ed25519.PrivateKeySize || bytes.Equal(ed25519.PrivateKey(privKey).Public().(ed25519.PublicKey), pubKey) != true {
+		t.Fatal("private key does not derive the public key")
+	}
+	if string(privComment) != comment {
+		t.Fatalf("comment = %q, want %q", privComment, comment)
+	}
+	for padNum, pad := range padding {
+		if pad != byte(padNum+1) {
+			t.Fatalf("padding = %v", padding)
+		}
+	}
+}
+
+// TestGenerateSSHKeyWithSSHKeygen has ssh-keygen read the private key back,
+// when it is installed.
+func TestGenerateSSHKeyWithSSHKeygen(t *testing.T) {
+	if _, err := exec.LookPath(cmdSSHKeygen); err != nil {
+		t.Skip("ssh-keygen is not installed")
+	}
+	keyPair, err := generateSSHKey(fixedRandom(), "dev@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(keyPath, keyPair.PrivateKey, 0600); err != nil {
+		t.Fatal(err)
+	}
+	pubOut, err := exec.Command(cmdSSHKeygen, "-y", "-f", keyPath).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Fields(string(pubOut))[1] != strings.Fields(keyPair.AuthorizedKey)[1] {
+		t.Fatalf("ssh-keygen -y = %q, want %q", pubOut, keyPair.AuthorizedKey)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// stateDir keeps what dev4os did on earlier runs, so a run can tell what
+// changed since then.
+var stateDir = envDir("XDG_STATE_HOME", homeDir()+".local/state/") + "dev4os/"
+
+// loadState reads a state file into value, leaving value as it is when the
+// file does not exist yet.
+func loadState(name string, value any) {
+	stateFile, err := os.ReadFile(stateDir + name)
+	if os.IsNotExist(err) {
+		return
+	}
+	checkError(err, "Failed to read state \""+stateDir+name+"\"")
+	checkError(json.Unmarshal(stateFile, value), "Failed to parse state \""+stateDir+name+"\"")
+}
+
+func saveState(name string, value any) {
+	stateFile, err := json.MarshalIndent(value, "", "  ")
+	checkError(err, "Failed to encode state \""+name+"\"")
+	makeDirectory(stateDir)
+	makeFile(stateDir+name, string(stateFile)+"\n", 0644)
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var (
+	terminalManagedLine = "Managed by dev4os, regenerated by \"dev4os terminal\"."
+	gnomeProfileID      = "0d4e0a5e-7e4d-4c2b-9d0e-de4050500001"
+	gnomeDconfDir       = "/org/gnome/terminal/legacy/"
+	// terminalActions names each key binding action in Alacritty, Kitty,
+	// WezTerm and GNOME Terminal, in that order. Alacritty has no tabs, so
+	// new_tab opens a window there.
+	terminalActions = map[string][4]string{
+		"copy":          {"Copy", "copy_to_clipboard", "act.CopyTo 'Clipboard'", "copy"},
+		"paste":         {"Paste", "paste_from_clipboard", "act.PasteFrom 'Clipboard'", "paste"},
+		"new_tab":       {"CreateNewWindow", "new_tab", "act.SpawnTab 'CurrentPaneDomain'", "new-tab"},
+		"new_window":    {"CreateNewWindow", "new_os_window", "act.SpawnWindow", "new-window"},
+		"font_increase": {"IncreaseFontSize", "change_font_size all +1.0", "act.IncreaseFontSize", "zoom-in"},
+		"font_decrease": {"DecreaseFontSize", "change_font_size all -1.0", "act.DecreaseFontSize", "zoom-out"},
+		"font_reset":    {"ResetFontSize", "change_font_size all 0", "act.ResetFontSize", "zoom-normal"},
+	}
+	// terminalKeys names the keys other than letters and digits the same way.
+	terminalKeys = map[string][4]string{
+		"plus":  {"Plus", "plus", "+", "plus"},
+		"minus": {"Minus", "minus", "-", "minus"},
+		"equal": {"Equals", "equal", "=", "equal"},
+		"enter": {"Enter", "enter", "Enter", "Return"},
+		"tab":   {"Tab", "tab", "Tab", "Tab"},
+	}
+	terminalMods = map[string][4]string{
+		"ctrl":  {"Control", "ctrl", "CTRL", "<Primary>"},
+		"shift": {"Shift", "shift", "SHIFT", "<Shift>"},
+		"alt":   {"Alt", "alt", "ALT", "<Alt>"},
+		"super": {"Super", "super", "SUPER", "<Super>"},
+	}
+)
+
+// terminalManifest is the team look of every terminal emulator. Palette
+// holds the 8 normal then the 8 bright ANSI colours. Emulators lists the
+// ones to configure, every installed one when it is empty.
+type terminalManifest struct {
+	Font      terminalFont   `json:"font"`
+	Colors    terminalColors `json:"colors"`
+	Keys      []terminalKey  `json:"keys"`
+	Emulators []string       `json:"emulators"`
+}
+
+type terminalFont struct {
+	Family string  `json:"family"`
+	Size   float64 `json:"size"`
+}
+
+type terminalColors struct {
+	Foreground string   `json:"foreground"`
+	Background string   `json:"background"`
+	Cursor     string   `json:"cursor"`
+	Palette    []string `json:"palette"`
+}
+
+// terminalKey binds key with mods such as "ctrl+shift" to one of the
+// terminalActions.
+type terminalKey struct {
+	Key    string `json:"key"`
+	Mods   string `json:"mods"`
+	Action string `json:"action"`
+}
+
+// terminalEmulator is a terminal whose whole config file dev4os writes.
+// Comment starts a comment line in that file.
+type terminalEmulator struct {
+	Name    string
+	Command string
+	Path    string
+	Comment string
+	Render  func(terminalManifest) string
+}
+
+func terminalEmulators() []terminalEmulator {
+	configDir := envDir("XDG_CONFIG_HOME", homeDir()+".config/")
+	return []terminalEmulator{
+		{"alacritty", "alacritty", configDir + "alacritty/alacritty.toml", "#", renderAlacritty},
+		{"kitty", "kitty", configDir + "kitty/kitty.conf", "#", renderKitty},
+		{"wezterm", "wezterm", configDir + "wezterm/wezterm.lua", "--", renderWezTerm},
+		{"gnome-terminal", "gnome-terminal", confDir + "gnome-terminal.dconf", "#", renderGnomeTerminal},
+	}
+}
+
+func (term terminalManifest) check() {
+	if len(term.Colors.Palette) != 16 {
+		messageError("fatal", "Terminal palette needs 16 colours, found "+strconv.Itoa(len(term.Colors.Palette)), "Terminal")
+	}
+	for _, key := range term.Keys {
+		if _, ok := terminalActions[key.Action]; ok != true {
+			messageError("fatal", "Unknown terminal action \""+key.Action+"\"", "Terminal")
+		}
+		if _, ok := terminalKeys[key.Key]; ok != true && (len(key.Key) != 1 || strings.ContainsAny(key.Key, "abcdefghijklmnopqrstuvwxyz0123456789") != true) {
+			messageError("fatal", "Unknown terminal key \""+key.Key+"\"", "Terminal")
+		}
+		for _, mod := range strings.Split(key.Mods, "+") {
+			if _, ok := terminalMods[mod]; ok != true && mod != "" {
+				messageError("fatal", "Unknown terminal modifier \""+mod+"\"", "Terminal")
+			}
+		}
+	}
+}
+
+// keyName is key in the syntax of the emulator at column of terminalKeys.
+// Alacritty writes letters in upper case.
+func keyName(key string, column int) string {
+	if namedKey, ok := terminalKeys[key]; ok == true {
+		return namedKey[column]
+	} else if column == 0 {
+		return strings.ToUpper(key)
+	}
+	return key
+}
+
+func modNames(mods string, column int) []string {
+	var names []string
+	for _, mod := range strings.Split(mods, "+") {
+		if mod != "" {
+			names = append(names, terminalMods[mod][column])
+		}
+	}
+	return names
+}
+
+func hexColor(color string) string {
+	return "'" + color + "'"
+}
+
+func renderAlacritty(term terminalManifest) string {
+	config := "[font]\nsize = " + strconv.FormatFloat(term.Font.Size, 'f', 1, 64) + "\n\n" +
+		"[font.normal]\nfamily = \"" + term.Font.Family + "\"\n\n" +
+		"[colors.primary]\nforeground = \"" + term.Colors.Foreground + "\"\nbackground = \"" + term.Colors.Background + "\"\n\n" +
+		"[colors.cursor]\ncursor = \"" + term.Colors.Cursor + "\"\ntext = \"" + term.Colors.Background + "\"\n"
+	colorNames := []string{"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white"}
+	for paletteNum, paletteName := range []string{"normal", "bright"} {
+		config += "\n[colors." + paletteName + "]\n"
+		for colorNum, colorName := range colorNames {
+			config += colorName + " = \"" + term.Colors.Palette[paletteNum*8+colorNum] + "\"\n"
+		}
+	}
+	for _, key := range term.Keys {
+		config += "\n[[keyboard.bindings]]\nkey = \"" + keyName(key.Key, 0) + "\"\n"
+		if key.Mods != "" {
+			config += "mods = \"" + strings.Join(modNames(key.Mods, 0), "|") + "\"\n"
+		}
+		config += "action = \"" + terminalActions[key.Action][0] + "\"\n"
+	}
+	return config
+}
+
+func renderKitty(term terminalManifest) string {
+	config := "font_family " + term.Font.Family + "\n" +
+		"font_size " + strconv.FormatFloat(term.Font.Size, 'f', 1, 64) + "\n\n" +
+		"foreground " + term.Colors.Foreground + "\n" +
+		"background " + term.Colors.Background + "\n" +
+		"cursor " + term.Colors.Cursor + "\n"
+	for colorNum, color := range term.Colors.Palette {
+		config += "color" + strconv.Itoa(colorNum) + " " + color + "\n"
+	}
+	if len(term.Keys) > 0 {
+		config += "\n"
+	}
+	for _, key := range term.Keys {
+		config += "map " + strings.Join(append(modNames(key.Mods, 1), keyName(key.Key, 1)), "+") + " " + terminalActions[key.Action][1] + "\n"
+	}
+	return config
+}
+
+func renderWezTerm(term terminalManifest) string {
+	var ansiColors, brightColors, keyLines []string
+	for colorNum, color := range term.Colors.Palette {
+		if colorNum < 8 {
+			ansiColors = append(ansiColors, hexColor(color))
+		} else {
+			brightColors = append(brightColors, hexColor(color))
+		}
+	}
+	for _, key := range term.Keys {
+		keyLines = append(keyLines, "    { key = '"+keyName(key.Key, 2)+"', mods = '"+strings.Join(modNames(key.Mods, 2), "|")+"', action = "+terminalActions[key.Action][2]+" },")
+	}
+	return "local wezterm = require 'wezterm'\n" +
+		"local act = wezterm.action\n\n" +
+		"return {\n" +
+		"  font = wezterm.font '" + term.Font.Family + "',\n" +
+		"  font_size = " + strconv.FormatFloat(term.Font.Size, 'f', 1, 64) + ",\n" +
+		"  colors = {\n" +
+		"    foreground = " + hexColor(term.Colors.Foreground) + ",\n" +
+		"    background = " + hexColor(term.Colors.Background) + ",\n" +
+		"    cursor_bg = " + hexColor(term.Colors.Cursor) + ",\n" +
+		"    cursor_border = " + hexColor(term.Colors.Cursor) + ",\n" +
+		"    ansi = { " + strings.Join(ansiColors, ", ") + " },\n" +
+		"    brights = { " + strings.Join(brightColors, ", ") + " },\n" +
+		"  },\n" +
+		"  keys = {\n" + strings.Join(keyLines, "\n") + "\n  },\n" +
+		"}\n"
+}
+
+// gnomeProfiles is the profile list of GNOME Terminal with the dev4os
+// profile added, so loading it keeps the user's own profiles.
+func gnomeProfiles() []string {
+	profileIDs := []string{}
+	readList, _ := exec.Command("dconf", "read", gnomeDconfDir+"profiles:/list").Output()
+	for _, profileID := range strings.Split(strings.Trim(strings.TrimSpace(string(readList)), "[]"), ",") {
+		if profileID = strings.Trim(strings.TrimSpace(profileID), "'"); profileID != "" && profileID != gnomeProfileID {
+			profileIDs = append(profileIDs, "'"+profileID+"'")
+		}
+	}
+	return append(profileIDs, "'"+gnomeProfileID+"'")
+}
+
+// renderGnomeTerminal is a "dconf load" file for /org/gnome/terminal/legacy/
+// that adds a dev4os profile and makes it the default.
+func renderGnomeTerminal(term terminalManifest) string {
+	var paletteColors, keyLines []string
+	for _, color := range term.Colors.Palette {
+		paletteColors = append(paletteColors, hexColor(color))
+	}
+	for _, key := range term.Keys {
+		keyLines = append(keyLines, terminalActions[key.Action][3]+"='"+strings.Join(modNames(key.Mods, 3), "")+keyName(key.Key, 3)+"'")
+	}
+	return "[profiles:]\n" +
+		"list=[" + strings.Join(gnomeProfiles(), ", ") + "]\n" +
+		"default='" + gnomeProfileID + "'\n\n" +
+		"[profiles:/:" + gnomeProfileID + "]\n" +
+		"visible-name='dev4os'\n" +
+		"use-system-font=false\n" +
+		"font='" + term.Font.Family + " " + strconv.FormatFloat(term.Font.Size, 'f', -1, 64) + "'\n" +
+		"use-theme-colors=false\n" +
+		"foreground-color=" + hexColor(term.Colors.Foreground) + "\n" +
+		"background-color=" + hexColor(term.Colors.Background) + "\n" +
+		"cursor-colors-set=true\n" +
+		"cursor-background-color=" + hexColor(term.Colors.Cursor) + "\n" +
+		"cursor-foreground-color=" + hexColor(term.Colors.Background) + "\n" +
+		"palette=[" + strings.Join(paletteColors, ", ") + "]\n\n" +
+		"[keybindings]\n" + strings.Join(keyLines, "\n") + "\n"
+}
+
+// writeTerminalConfig writes the config of one emulator. A file dev4os did
+// not write is pointed out with its copy in the backup set.
+func writeTerminalConfig(emulator terminalEmulator, term terminalManifest) {
+	managedLine := emulator.Comment + " " + terminalManagedLine
+	if oldConfig := readFileContents(emulator.Path); oldConfig != "" && strings.HasPrefix(oldConfig, managedLine) != true {
+		fmt.Println(clrYellow + "  ~ " + clrReset + "Saved \"" + emulator.Path + "\" as \"" + snapshotFile(emulator.Path) + "\"")
+	}
+	makeDirectory(filepath.Dir(emulator.Path))
+	makeFile(emulator.Path, managedLine+"\n"+emulator.Render(term), 0644)
+
+	if emulator.Name == "gnome-terminal" {
+		// The settings as they were go into the backup set of this run, so
+		// a second run does not overwrite the dump of the first.
+		dumpConf, err := exec.Command("dconf", "dump", gnomeDconfDir).Output()
+		checkError(err, "Failed to read GNOME Terminal settings")
+		dumpPath := backupRunPath("gnome-terminal.dconf")
+		makeFile(dumpPath, string(dumpConf), 0644)
+		fmt.Println(clrYellow + "  ~ " + clrReset + "Saved GNOME Terminal settings as \"" + dumpPath + "\", undo with\n" +
+			"      dconf reset -f " + gnomeDconfDir + " && dconf load " + gnomeDconfDir + " < \"" + dumpPath + "\"")
+		loadConf := exec.Command("dconf", "load", gnomeDconfDir)
+		loadConf.Stdin = strings.NewReader(readFileContents(emulator.Path))
+		checkError(loadConf.Run(), "Failed to load \""+emulator.Path+"\" into dconf")
+	}
+	fmt.Println(clrGreen + "  + " + clrReset + emulator.Name + " " + clrGrey + emulator.Path + clrReset)
+	if emulator.Name == "wezterm" && checkExists(homeDir()+".wezterm.lua") == true {
+		fmt.Println(clrYellow + "  ~ " + clrReset + "\"" + homeDir() + ".wezterm.lua\" is read by WezTerm instead, remove it to use this config")
+	}
+}
+
+// confTerminal writes the team profile for the emulators named in args, the
+// manifest or installed, in that order of preference.
+func confTerminal(args []string) {
+	term := loadManifest().Terminal
+	term.check()
+	emulatorNames := args
+	if len(emulatorNames) == 0 {
+		emulatorNames = term.Emulators
+	}
+
+	fmt.Println(clrCyan + "Terminal profiles" + clrReset)
+	for _, emulatorName := range emulatorNames {
+		knownEmulator := false
+		for _, emulator := range terminalEmulators() {
+			knownEmulator = knownEmulator || emulatorName == emulator.Name
+		}
+		if knownEmulator != true {
+			messageError("fatal", "Unknown terminal \""+emulatorName+"\", use alacritty, kitty, wezterm or gnome-terminal", "Terminal")
+		}
+	}
+	configured := 0
+	for _, emulator := range terminalEmulators() {
+		emulatorWanted := len(emulatorNames) == 0
+		for _, emulatorName := range emulatorNames {
+			emulatorWanted = emulatorWanted || emulatorName == emulator.Name
+		}
+		if emulatorWanted != true {
+			continue
+		}
+		if _, err := exec.LookPath(emulator.Command); err != nil && len(emulatorNames) == 0 {
+			continue
+		} else if _, err := exec.LookPath("dconf"); err != nil && emulator.Name == "gnome-terminal" {
+			messageError("print", "Can't find dconf to load the GNOME Terminal profile", "Terminal")
+			continue
+		}
+		writeTerminalConfig(emulator, term)
+		configured++
+	}
+	if configured == 0 {
+		fmt.Println(lstDot + "No Alacritty, Kitty, WezTerm or GNOME Terminal found, name one to write its config anyway.")
+		return
+	}
+	fmt.Println(lstDot + "Terminal profiles use " + clrPurple + term.Font.Family + clrReset + ", restart the terminal to load them.")
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"dev4os/shellrc"
+	"embed"
+	"flag"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	themeBackends     = []string{"p10k", "starship"}
+	p10kConfigDir     = confDir + "p10k/"
+	starshipConfigDir = confDir + "starship/"
+	p10kEngine        = zshPlugin{Repo: "romkatv/powerlevel10k", Source: "powerlevel10k.zsh-theme"}
+	//go:embed dev4p10k
+	p10kBase string
+	//go:embed templates/themes
+	themeTemplates embed.FS
+	// presetRenames maps the p10k presets the dev4mac installer downloaded to
+	// the preset that replaced each, so a manifest or -preset with an old name
+	// keeps working.
+	presetRenames = map[string]string{
+		"minimalism":  "minimal",
+		"atelier":     "dev4os",
+		"seeking":     "tmux",
+		"operations":  "ops",
+		"engineering": "dev4os",
+	}
+)
+
+// themeManifest selects the prompt. Backend is "p10k" or "starship" and
+// Preset is used in every terminal no rule matches.
+type themeManifest struct {
+	Backend string      `json:"backend"`
+	Preset  string      `json:"preset"`
+	Rules   []themeRule `json:"rules"`
+	P10k    p10kOptions `json:"p10k"` // how dev4p10k is rendered under every p10k preset
+}
+
+// themeRule picks the preset of a terminal by a variable it sets, such as
+// TERM_PROGRAM=iTerm.app. The first matching rule wins.
+type themeRule struct {
+	Env    string `json:"env"`
+	Value  string `json:"value"`
+	Preset string `json:"preset"`
+}
+
+func themeExt(backend string) string {
+	if backend == "starship" {
+		return ".toml"
+	}
+	return ".zsh"
+}
+
+func themePresets(backend string) []string {
+	var presets []string
+	presetFiles, err := themeTemplates.ReadDir("templates/themes/" + backend)
+	checkError(err, "Failed to read theme presets of \""+backend+"\"")
+	for _, presetFile := range presetFiles {
+		presets = append(presets, strings.TrimSuffix(presetFile.Name(), themeExt(backend)))
+	}
+	return presets
+}
+
+func themePreset(backend, name string) string {
+	rawPreset, err := themeTemplates.ReadFile("templates/themes/" + backend + "/" + name + themeExt(backend))
+	if err != nil {
+		messageError("fatal", "Unknown "+backend+" preset \""+name+"\", see \"dev4os theme list\"", "Theme")
+	}
+	return string(rawPreset)
+}
+
+func themeConfigPath(backend, name string) string {
+	if backend == "starship" {
+		return starshipConfigDir + name + ".toml"
+	}
+	return p10kConfigDir + name + ".zsh"
+}
+
+// usedPresets lists the default preset and the preset of every rule, each
+// once.
+func (theme themeManifest) usedPresets() []string {
+	presets := []string{theme.Preset}
+	for _, rule := range theme.Rules {
+		presets = appendUnique(presets, rule.Preset)
+	}
+	return presets
+}
+
+// renamedPreset is the current name of a preset, with a notice when name is
+// an old one.
+func renamedPreset(name string) string {
+	if newName, ok := presetRenames[name]; ok == true {
+		fmt.Println(clrYellow + "  ~ " + clrReset + "preset " + name + " is called " + clrPurple + newName + clrReset + " now")
+		return newName
+	}
+	return name
+}
+
+// renamePresets moves the default preset and the preset of every rule off
+// the old names.
+func (theme themeManifest) renamePresets() themeManifest {
+	theme.Preset = renamedPreset(theme.Preset)
+	rules := make([]themeRule, len(theme.Rules))
+	for ruleNum, rule := range theme.Rules {
+		rule.Preset = renamedPreset(rule.Preset)
+		rules[ruleNum] = rule
+	}
+	theme.Rules = rules
+	return theme
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, oldValue := range values {
+		if oldValue == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+// writeThemePreset writes the config of a preset. A p10k preset only sets
+// what differs from dev4p10k, so it is written after the rendered config.
+func writeThemePreset(theme themeManifest, name string) {
+	presetHeader := "# Generated by dev4os from the \"" + name + "\" " + theme.Backend + " preset, run \"dev4os theme\" to update.\n"
+	presetConfig := themePreset(theme.Backend, name)
+	if theme.Backend == "p10k" {
+		presetConfig = renderP10k(theme.P10k) + "\n" + presetConfig
+		checkP10k(presetConfig)
+	}
+	configPath := themeConfigPath(theme.Backend, name)
+	makeDirectory(filepath.Dir(configPath))
+	makeFile(configPath, presetHeader+presetConfig, 0644)
+}
+
+// renderThemeRules picks the line of each preset by the rules, in the syntax
+// of userShell. Without rules it is the line of the default preset.
+func renderThemeRules(userShell shell, theme themeManifest, presetLine func(string) shellrc.Line) string {
+	defaultLine := strings.TrimRight(renderSnippet(userShell, presetLine(theme.Preset)), "\n")
+	if len(theme.Rules) == 0 {
+		return defaultLine + "\n"
+	}
+
+	var ruleLines []string
+	for ruleNum, rule := range theme.Rules {
+		ruleTest := "[ \"$" + rule.Env + "\" = \"" + rule.Value + "\" ]; then"
+		if userShell.Name() == "fish" {
+			ruleTest = "test \"$" + rule.Env + "\" = \"" + rule.Value + "\""
+		}
+		if ruleNum == 0 {
+			ruleLines = append(ruleLines, "if "+ruleTest)
+		} else if userShell.Name() == "fish" {
+			ruleLines = append(ruleLines, "else if "+ruleTest)
+		} else {
+			ruleLines = append(ruleLines, "elif "+ruleTest)
+		}
+		ruleLines = append(ruleLines, "  "+strings.TrimRight(renderSnippet(userShell, presetLine(rule.Preset)), "\n"))
+	}
+	ruleLines = append(ruleLines, "else", "  "+defaultLine)
+	if userShell.Name() == "fish" {
+		ruleLines = append(ruleLines, "end")
+	} else {
+		ruleLines = append(ruleLines, "fi")
+	}
+	return strings.Join(ruleLines, "\n") + "\n"
+}
+
+// installP10k checks out powerlevel10k next to the zsh plugins, pinned in
+// the same lock file.
+func installP10k() {
+	pins := loadZshLock()
+	if pins[p10kEngine.Repo] == "" {
+		pins[p10kEngine.Repo] = resolvePluginRef(p10kEngine)
+	}
+	checkoutPlugin(p10kEngine, pins[p10kEngine.Repo])
+	saveZshLock(pins)
+	fmt.Println(clrGreen + "  = " + clrReset + p10kEngine.Repo + " " + shortCommit(pins[p10kEngine.Repo]))
+}
+
+// clearTheme removes the theme blocks from every rc file but keepPath, so
+// switching backend or login shell leaves one prompt behind.
+func clearTheme(keepPath, backend string) {
+	for _, userShell := range []shell{zshShell{}, bashShell{}, fishShell{}} {
+		rcPath := userShell.RCPath()
+		rcContents := readFileContents(rcPath)
+		newContents := rcContents
+		if rcPath != keepPath {
+			newContents = removeBlock(newContents, "theme")
+		}
+		if rcPath != keepPath || backend != "p10k" {
+			newContents = removeBlock(newContents, "p10k-instant-prompt")
+		}
+		if newContents != rcContents {
+			makeFile(rcPath, newContents, 0644)
+		}
+	}
+}
+
+// applyTheme writes the config of every preset the theme uses and the block
+// that picks one per terminal. p10k only runs in zsh, starship is set up for
+// the login shell.
+func applyTheme(theme themeManifest) {
+	fmt.Println(clrCyan + "Prompt theme" + clrReset + " with " + clrPurple + theme.Backend + clrReset)
+	for _, preset := range theme.usedPresets() {
+		writeThemePreset(theme, preset)
+		fmt.Println(clrGreen + "  + " + clrReset + preset + " " + clrGrey + themeConfigPath(theme.Backend, preset) + clrReset)
+	}
+
+	var userShell shell
+	var themeBody string
+	if theme.Backend == "p10k" {
+		installP10k()
+		userShell = zshShell{}
+		themeBody = renderSnippet(userShell, shellrc.Source(homeShellPath(p10kEngine.SourceFile()))) +
+			renderThemeRules(userShell, theme, func(preset string) shellrc.Line {
+				return shellrc.Source(homeShellPath(themeConfigPath("p10k", preset)))
+			})
+		writeFirstBlock(userShell.RCPath(), "p10k-instant-prompt",
+			"if [[ -r \"${XDG_CACHE_HOME:-$HOME/.cache}/p10k-instant-prompt-${(%):-%n}.zsh\" ]]; then\n"+
+				"  source \"${XDG_CACHE_HOME:-$HOME/.cache}/p10k-instant-prompt-${(%):-%n}.zsh\"\n"+
+				"fi\n", 0644)
+	} else {
+		if _, err := exec.LookPath("starship"); err != nil {
+			messageError("print", "Can't find starship, install it to see the prompt", "Theme")
+		}
+		userShell = loginShell()
+		themeBody = renderThemeRules(userShell, theme, func(preset string) shellrc.Line {
+			return shellrc.Export("STARSHIP_CONFIG", homeShellPath(themeConfigPath("starship", preset)))
+		}) + renderSnippet(userShell, shellrc.Eval("starship init "+userShell.Name()))
+	}
+	clearTheme(userShell.RCPath(), theme.Backend)
+	writeManagedBlock(userShell.RCPath(), "theme", themeBody, 0644)
+	saveState("theme.json", theme)
+	fmt.Println(lstDot + "Prompt " + clrPurple + theme.Preset + clrReset + " loaded from \"" + userShell.RCPath() + "\", open a new terminal to see it.")
+}
+
+// appliedTheme is the theme the last "dev4os theme" wrote, or the manifest
+// theme before the first run.
+func appliedTheme(teamManifest manifest) themeManifest {
+	theme := teamManifest.Theme
+	loadState("theme.json", &theme)
+	return theme
+}
+
+func listThemes(theme themeManifest) {
+	for _, backend := range themeBackends {
+		fmt.Println(clrCyan + backend + clrReset)
+		for _, preset := range themePresets(backend) {
+			presetMark := "  "
+			if backend == theme.Backend && preset == theme.Preset {
+				presetMark = clrGreen + "* " + clrReset
+			}
+			fmt.Println("  " + presetMark + preset)
+		}
+	}
+	for _, rule := range theme.Rules {
+		fmt.Println(lstDot + rule.Env + "=" + rule.Value + " uses " + clrPurple + rule.Preset + clrReset)
+	}
+}
+
+func themeMain(args []string) {
+	theme := loadManifest().Theme.renamePresets()
+	if len(args) > 0 && args[0] == "list" {
+		listThemes(theme)
+		return
+	} else if len(args) > 0 && args[0] == "p10k" {
+		confP10k(args[1:])
+		return
+	}
+
+	themeFlags := flag.NewFlagSet("theme", flag.ExitOnError)
+	backend := themeFlags.String("backend", theme.Backend, "prompt backend, p10k or starship")
+	preset := themeFlags.String("preset", theme.Preset, "preset used when no terminal rule matches")
+	checkError(themeFlags.Parse(args), "Failed to parse theme options")
+	if *backend != "p10k" && *backend != "starship" {
+		messageError("fatal", "Unknown theme backend \""+*backend+"\", use p10k or starship", "Theme")
+	}
+	theme.Backend = *backend
+	theme.Preset = renamedPreset(*preset)
+	theme.P10k = savedP10k(theme.P10k)
+	for _, usedPreset := range theme.usedPresets() {
+		themePreset(theme.Backend, usedPreset)
+	}
+	if themeFlags.NArg() > 0 {
+		printUsage()
+		messageError("fatal", "Unknown theme command \""+themeFlags.Arg(0)+"\"", "Usage")
+	}
+	applyTheme(theme)
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"dev4os/shellrc"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	zshPluginDir = envDir("XDG_DATA_HOME", homeDir()+".local/share/") + "dev4os/zsh-plugins/"
+	zshLockPath  = confDir + "zsh-plugins.lock"
+)
+
+// zshManifest lists the zsh plugins in load order. Manager is "builtin",
+// "antidote", "zinit" or "auto", which uses antidote or zinit when installed.
+type zshManifest struct {
+	Manager string      `json:"manager"`
+	Plugins []zshPlugin `json:"plugins"`
+}
+
+// zshPlugin is a GitHub repository such as "zsh-users/zsh-autosuggestions".
+// Ref is the tag or branch "dev4os zsh update" follows, the default branch
+// when empty. Fpath names the directory of a completion plugin, which is added
+// to fpath before compinit instead of being sourced.
+type zshPlugin struct {
+	Repo   string `json:"repo"`
+	Ref    string `json:"ref"`
+	Source string `json:"source"`
+	Fpath  string `json:"fpath"`
+}
+
+// zshLock maps each plugin repository to the commit it is pinned to. It sits
+// next to the team manifest, so it can be shared the same way.
+type zshLock map[string]string
+
+func (plugin zshPlugin) Name() string {
+	return filepath.Base(plugin.Repo)
+}
+
+func (plugin zshPlugin) URL() string {
+	return "https://github.com/" + plugin.Repo + ".git"
+}
+
+func (plugin zshPlugin) Dir() string {
+	return zshPluginDir + plugin.Name()
+}
+
+// SourceFile is the file that loads the plugin, by the usual names when the
+// manifest does not give one.
+func (plugin zshPlugin) SourceFile() string {
+	if plugin.Source != "" {
+		return plugin.Dir() + "/" + plugin.Source
+	}
+	for _, sourceName := range []string{".plugin.zsh", ".zsh", ".zsh-theme"} {
+		if checkExists(plugin.Dir()+"/"+plugin.Name()+sourceName) == true {
+			return plugin.Dir() + "/" + plugin.Name() + sourceName
+		}
+	}
+	return plugin.Dir() + "/" + plugin.Name() + ".plugin.zsh"
+}
+
+// homeShellPath writes a path under the home directory with $HOME.
+func homeShellPath(filePath string) string {
+	return homeValue(strings.Replace(filePath, homeDir(), "~/", 1))
+}
+
+func loadZshLock() zshLock {
+	pins := zshLock{}
+	if lockFile := readFileContents(zshLockPath); lockFile != "" {
+		checkError(json.Unmarshal([]byte(lockFile), &pins), "Failed to parse \""+zshLockPath+"\"")
+	}
+	return pins
+}
+
+func saveZshLock(pins zshLock) {
+	lockFile, err := json.MarshalIndent(pins, "", "  ")
+	checkError(err, "Failed to encode zsh plugin pins")
+	makeDirectory(confDir)
+	makeFile(zshLockPath, string(lockFile)+"\n", 0644)
+}
+
+// shortCommit abbreviates a pin to 7 characters the way git log --oneline
+// does. A pin written by hand can be shorter, and is shown as it is.
+func shortCommit(commit string) string {
+	if len(commit) > 7 {
+		return commit[:7]
+	}
+	return commit
+}
+
+func gitPlugin(plugin zshPlugin, args ...string) (string, error) {
+	gitOut, err := exec.Command(cmdGit, append([]string{"-C", plugin.Dir()}, args...)...).Output()
+	return strings.TrimSpace(string(gitOut)), err
+}
+
+// resolvePluginRef fetches the plugin and returns the commit of its ref.
+func resolvePluginRef(plugin zshPlugin) string {
+	if checkExists(plugin.Dir()) != true {
+		makeDirectory(zshPluginDir)
+		gitClone := exec.Command(cmdGit, "clone", "--quiet", plugin.URL(), plugin.Dir())
+		gitClone.Stderr = os.Stderr
+		checkError(gitClone.Run(), "Failed to clone "+plugin.Repo)
+	} else {
+		_, err := gitPlugin(plugin, "fetch", "--quiet", "--tags", "origin")
+		checkCmdError(err, "Failed to fetch", plugin.Repo)
+	}
+
+	pluginRef := "origin/HEAD"
+	if plugin.Ref != "" {
+		pluginRef = plugin.Ref
+	}
+	for _, refName := range []string{pluginRef, "origin/" + pluginRef} {
+		if commit, err := gitPlugin(plugin, "rev-parse", "--verify", "--quiet", refName+"^{commit}"); err == nil {
+			return commit
+		}
+	}
+	messageError("fatal", "Can't find ref \""+pluginRef+"\" of "+plugin.Repo, "zsh plugin")
+	return ""
+}
+
+// checkoutPlugin puts the plugin at its pinned commit, fetching only when the
+// clone does not have that commit yet.
+func checkoutPlugin(plugin zshPlugin, commit string) {
+	if checkExists(plugin.Dir()) != true {
+		resolvePluginRef(plugin)
+	} else if _, err := gitPlugin(plugin, "cat-file", "-e", commit+"^{commit}"); err != nil {
+		_, err := gitPlugin(plugin, "fetch", "--quiet", "--tags", "origin")
+		checkCmdError(err, "Failed to fetch", plugin.Repo)
+	}
+	_, err := gitPlugin(plugin, "checkout", "--quiet", "--detach", commit)
+	checkError(err, "Failed to check out "+plugin.Repo+" at "+commit)
+}
+
+// zshPluginManager finds antidote or zinit for the "auto" manager and returns
+// the file to source with it, or "builtin" and no file.
+func zshPluginManager(name string) (string, string) {
+	antidotePaths := []string{envDir("ZDOTDIR", homeDir()) + ".antidote/antidote.zsh", brewPrefix() + "share/antidote/antidote.zsh"}
+	zinitPaths := []string{envDir("XDG_DATA_HOME", homeDir()+".local/share/") + "zinit/zinit.git/zinit.zsh"}
+	if name == "antidote" || name == "auto" {
+		for _, antidotePath := range antidotePaths {
+			if checkExists(antidotePath) == true {
+				return "antidote", antidotePath
+			}
+		}
+	}
+	if name == "zinit" || name == "auto" {
+		for _, zinitPath := range zinitPaths {
+			if checkExists(zinitPath) == true {
+				return "zinit", zinitPath
+			}
+		}
+	}
+	if name != "builtin" && name != "auto" && name != "" {
+		messageError("fatal", "Can't find "+name+", install it or set zsh manager to builtin", "zsh plugin")
+	}
+	return "builtin", ""
+}
+
+// renderZshPlugins loads completion plugins into fpath first, runs compinit
+// once, then sources the other plugins in the order of the manifest.
+func renderZshPlugins(plugins []zshPlugin, pins zshLock, manager, managerPath string) string {
+	var fpathLines, sourceLines []string
+	switch manager {
+	case "antidote":
+		var bundleLines []string
+		for _, plugin := range plugins {
+			bundleLine := plugin.Repo + " pin:" + pins[plugin.Repo]
+			if plugin.Fpath != "" {
+				bundleLine += " kind:fpath path:" + plugin.Fpath
+			} else if plugin.Source != "" {
+				bundleLine += " path:" + plugin.Source
+			}
+			bundleLines = append(bundleLines, bundleLine)
+		}
+		bundlePath := confDir + "zsh-plugins.txt"
+		makeDirectory(confDir)
+		makeFile(bundlePath, strings.Join(bundleLines, "\n")+"\n", 0644)
+		return "source \"" + homeShellPath(managerPath) + "\"\n" +
+			"antidote load \"" + homeShellPath(bundlePath) + "\"\n" +
+			"autoload -Uz compinit && compinit\n"
+	case "zinit":
+		for _, plugin := range plugins {
+			if plugin.Fpath != "" {
+				fpathLines = append(fpathLines, "zinit ice ver\""+pins[plugin.Repo]+"\" blockf as\"completion\"", "zinit light "+plugin.Repo)
+			} else {
+				sourceLines = append(sourceLines, "zinit ice ver\""+pins[plugin.Repo]+"\"", "zinit light "+plugin.Repo)
+			}
+		}
+		return "source \"" + homeShellPath(managerPath) + "\"\n" + strings.Join(fpathLines, "\n") + "\n" +
+			"autoload -Uz compinit && compinit\n" + strings.Join(sourceLines, "\n") + "\n"
+	}
+
+	var fpathPlugins, sourcePlugins []shellrc.Line
+	for _, plugin := range plugins {
+		if plugin.Fpath != "" {
+			fpathPlugins = append(fpathPlugins, shellrc.Plugin(homeShellPath(plugin.Dir()+"/"+plugin.Fpath), ""))
+		} else {
+			sourcePlugins = append(sourcePlugins, shellrc.Plugin(homeShellPath(plugin.Dir()), strings.TrimPrefix(plugin.SourceFile(), plugin.Dir()+"/")))
+		}
+	}
+	return shellrc.Render("zsh", fpathPlugins...) + "autoload -Uz compinit && compinit\n" + shellrc.Render("zsh", sourcePlugins...)
+}
+
+// installZshPlugins checks out every plugin at its pinned commit, pinning the
+// commit of its ref the first time, and writes the load order into .zshrc.
+// With update set, every pin moves to the current commit of its ref.
+func installZshPlugins(update bool) {
+	teamManifest := loadManifest()
+	pins := loadZshLock()
+	manager, managerPath := zshPluginManager(teamManifest.Zsh.Manager)
+	fmt.Println(clrCyan + "zsh plugins" + clrReset + " with " + clrPurple + manager + clrReset)
+
+	for _, plugin := range teamManifest.Zsh.Plugins {
+		oldCommit := pins[plugin.Repo]
+		if oldCommit == "" || update == true {
+			if manager == "builtin" {
+				pins[plugin.Repo] = resolvePluginRef(plugin)
+			} else {
+				pins[plugin.Repo] = remotePluginRef(plugin)
+			}
+		}
+
+		if manager == "builtin" {
+			checkoutPlugin(plugin, pins[plugin.Repo])
+		}
+		if oldCommit != "" && oldCommit != pins[plugin.Repo] {
+			fmt.Println(clrGreen + "  ^ " + clrReset + plugin.Repo + " " + shortCommit(oldCommit) + " -> " + shortCommit(pins[plugin.Repo]))
+		} else {
+			fmt.Println(clrGreen + "  = " + clrReset + plugin.Repo + " " + shortCommit(pins[plugin.Repo]))
+		}
+	}
+	saveZshLock(pins)
+
+	rcPath := zshShell{}.RCPath()
+	writeManagedBlock(rcPath, "zsh-plugins", renderZshPlugins(teamManifest.Zsh.Plugins, pins, manager, managerPath), 0644)
+	fmt.Println(lstDot + "Plugins pinned in \"" + zshLockPath + "\" and loaded from \"" + rcPath + "\".")
+}
+
+// remotePluginRef asks the remote for the commit of a ref, for antidote and
+// zinit that clone the plugins themselves.
+func remotePluginRef(plugin zshPlugin) string {
+	pluginRef := "HEAD"
+	if plugin.Ref != "" {
+		pluginRef = plugin.Ref
+	}
+	lsRemote, err := exec.Command(cmdGit, "ls-remote", plugin.URL(), pluginRef, pluginRef+"^{}").Output()
+	checkError(err, "Failed to read refs of "+plugin.Repo)
+	commit := ""
+	for _, refLine := range strings.Split(strings.TrimSpace(string(lsRemote)), "\n") {
+		refFields := strings.Fields(refLine)
+		if len(refFields) == 2 && (commit == "" || strings.HasSuffix(refFields[1], "^{}")) {
+			commit = refFields[0]
+		}
+	}
+	if commit == "" {
+		messageError("fatal", "Can't find ref \""+pluginRef+"\" of "+plugin.Repo, "zsh plugin")
+	}
+	return commit
+}
+
+func zshMain(args []string) {
+	if len(args) == 0 {
+		installZshPlugins(false)
+	} else if args[0] == "update" {
+		installZshPlugins(true)
+	} else {
+		printUsage()
+		messageError("fatal", "Unknown zsh command \""+args[0]+"\"", "Usage")
+	}
+}
@@ -2,6 +2,9 @@ package main
 
 import (
 	"bufio"
+	"dev4os/bootstrap"
+	"dev4os/loginshell"
+	"dev4os/shellrc"
 	"errors"
 	"fmt"
 	"github.com/briandowns/spinner"
@@ -10,15 +13,19 @@ import (
 	"os"
 	"os/exec"
 	"os/user"
+	"strings"
 	"time"
 )
 
 var (
-	appVer    = "0.1"
-	lstDot    = " • "
-	superUser = "sudo"
-	cmdPMS    = "dnf"
-	pmsIns    = "install"
+	appVer      = "0.1"
+	lstDot      = " • "
+	userShell   = checkShell()
+	shrcPath    = shellRCPath()
+	profilePath = shellProfilePath()
+	superUser   = "sudo"
+	cmdPMS      = "dnf"
+	pmsIns      = "install"
 	//cmdReIns    = "reinstall"
 	pmsRm      = "remove"
 	pmsYes     = "-y"
@@ -27,15 +34,11 @@ var (
 	cmdSys     = "systemctl"
 	cmdEnable  = "enable"
 	//cmdDisable = "disable"
-	cmdStart   = "start"
-	cmdGit     = "git"
-	gitClone   = "clone"
-	cmdASDF    = homeDir() + ".asdf/"
-	asdfPlugin = "plugin"
-	asdfAdd    = "add"
-	asdfShim   = "reshim"
-	chooseCmd  = "Select command: "
-	cmdOpt     string
+	cmdStart  = "start"
+	cmdGit    = "git"
+	gitClone  = "clone"
+	chooseCmd = "Select command: "
+	cmdOpt    string
 )
 
 func checkError(err error) bool {
@@ -76,20 +79,37 @@ func checkLinuxVer() string {
 }
 
 func checkShell() string {
-	checkShell := exec.Command("echo", "$SHELL")
+	checkedShell := loginshell.Detect(currentUser())
 
-	checkedShell, err := checkShell.Output()
-	checkError(err)
-
-	if string(checkedShell) == "/bin/bash" || string(checkedShell) == "/usr/bin/bash" {
-		return "bash"
-	} else if string(checkedShell) == "/bin/zsh" || string(checkedShell) == "/usr/bin/zsh" {
-		return "zsh"
-	} else {
-		fmt.Println(lstDot + "Your shell is not supported, please use bash or zsh\n")
+	if checkedShell == "" {
+		fmt.Println(lstDot + "Your shell is not supported, please use bash, zsh or fish\n")
 		os.Exit(0)
-		return ""
 	}
+	return checkedShell
+}
+
+func shellRCPath() string {
+	if userShell == "fish" {
+		return homeDir() + ".config/fish/config.fish"
+	}
+	return homeDir() + "." + userShell + "rc"
+}
+
+func shellProfilePath() string {
+	if userShell == "bash" {
+		return homeDir() + ".bash_profile"
+	} else if userShell == "fish" {
+		return shellRCPath()
+	}
+	return homeDir() + ".zprofile"
+}
+
+// sourceHint is the command that loads the new rc files in a running shell.
+func sourceHint() string {
+	if userShell == "fish" {
+		return "source ~/.config/fish/config.fish"
+	}
+	return "source " + strings.Replace(profilePath, homeDir(), "~/", 1) + " && source " + strings.Replace(shrcPath, homeDir(), "~/", 1)
 }
 
 func homeDir() string {
@@ -98,12 +118,6 @@ func homeDir() string {
 	return homeDirPath + "/"
 }
 
-func workingDir() string {
-	workingDirPath, err := os.Getwd()
-	checkError(err)
-	return workingDirPath + "/"
-}
-
 func currentUser() string {
 	userName, err := user.Current()
 	checkError(err)
@@ -111,6 +125,7 @@ func currentUser() string {
 }
 
 func makeFile(filePath, fileContents string) {
+	checkError(bootstrap.Snapshot(filePath))
 	targetFile, err := os.OpenFile(filePath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, os.FileMode(0600))
 	checkError(err)
 	defer func() {
@@ -122,6 +137,7 @@ func makeFile(filePath, fileContents string) {
 }
 
 func appendFile(filePath, fileContents string) {
+	checkError(bootstrap.Snapshot(filePath))
 	targetFile, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, os.FileMode(0600))
 	checkError(err)
 	defer func() {
@@ -132,6 +148,14 @@ func appendFile(filePath, fileContents string) {
 	checkError(err)
 }
 
+// appendShell appends a snippet under a comment header, rendered for the
+// login shell. A snippet without a line for that shell is left out.
+func appendShell(filePath, header string, lines ...shellrc.Line) {
+	if shellContents := shellrc.Render(userShell, lines...); strings.TrimSpace(shellContents) != "" {
+		appendFile(filePath, "# "+header+"\n"+shellContents+"\n")
+	}
+}
+
 func rmFile(filePath string) {
 	if _, err := os.Stat(filePath); !os.IsNotExist(err) {
 		err := os.Remove(filePath)
@@ -140,35 +164,16 @@ func rmFile(filePath string) {
 }
 
 func newBashProfile(profilePath string) {
-	if _, err := os.Stat(profilePath); errors.Is(err, os.ErrNotExist) {
-		err := os.Rename(profilePath, homeDir()+".bash_profile.old")
-		checkError(err)
-	}
-
-	fileContents := "# " + currentUser() + "’s profile\n\n" +
-		"# BASH\n" +
-		"export SHELL=bash\n"
+	fileContents := "# " + currentUser() + "’s profile\n\n" + shellEnv()
 	makeFile(profilePath, fileContents)
 }
 
 func newZProfile(profilePath string) {
-	if _, err := os.Stat(profilePath); errors.Is(err, os.ErrNotExist) {
-		err := os.Rename(profilePath, homeDir()+".zprofile.old")
-		checkError(err)
-	}
-
-	fileContents := "# " + currentUser() + "’s profile\n\n" +
-		"# ZSH\n" +
-		"export SHELL=zsh\n"
+	fileContents := "# " + currentUser() + "’s profile\n\n" + shellEnv()
 	makeFile(profilePath, fileContents)
 }
 
 func newBashRC(shrcPath string) {
-	if _, err := os.Stat(shrcPath); errors.Is(err, os.ErrNotExist) {
-		err := os.Rename(shrcPath, homeDir()+".bashrc.old")
-		checkError(err)
-	}
-
 	fileContents := "#    ____    _    ____  _   _ ____   ____\n" +
 		"#  | __ )  / \\  / ___|| | | |  _ \\ / ___|\n" +
 		"#  |  _ \\ / _ \\ \\___ \\| |_| | |_) | |\n" +
@@ -178,11 +183,6 @@ func newBashRC(shrcPath string) {
 }
 
 func newZshRC(shrcPath string) {
-	if _, err := os.Stat(shrcPath); errors.Is(err, os.ErrNotExist) {
-		err := os.Rename(shrcPath, homeDir()+".zshrc.old")
-		checkError(err)
-	}
-
 	fileContents := "#    _________  _   _ ____   ____" +
 		"#  |__  / ___|| | | |  _ \\ / ___|" +
 		"#  / /\\___ \\| |_| | |_) | |" +
@@ -191,34 +191,18 @@ func newZshRC(shrcPath string) {
 	makeFile(shrcPath, fileContents)
 }
 
-func confA4s() {
-	dlA4sPath := workingDir() + ".dev4mac-alias4sh.sh"
-	resp, err := http.Get("https://raw.githubusercontent.com/leelsey/Alias4sh/main/install.sh")
-	if err != nil {
-		fmt.Println(lstDot + "Alias4sh‘s URL is maybe changed, please check https://github.com/leelsey/Alias4sh\n")
-		os.Exit(0)
-	}
-	defer func() {
-		err := resp.Body.Close()
-		checkError(err)
-	}()
-	rawFile, _ := ioutil.ReadAll(resp.Body)
-
-	a4sInstaller, err := os.OpenFile(dlA4sPath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, os.FileMode(0755))
-	checkError(err)
-	defer func() {
-		err := a4sInstaller.Close()
-		checkError(err)
-	}()
-	_, err = a4sInstaller.Write(rawFile)
-	checkError(err)
-
-	installA4s := exec.Command("/bin/sh", dlA4sPath)
-	if err := installA4s.Run(); err != nil {
-		rmFile(dlA4sPath)
+func newFishConfig(shrcPath string) {
+	if err := os.MkdirAll(homeDir()+".config/fish", 0755); err != nil {
 		checkError(err)
 	}
-	rmFile(dlA4sPath)
+	fileContents := "# " + currentUser() + "’s fish config\n\n" + shellEnv()
+	makeFile(shrcPath, fileContents)
+}
+
+// shellEnv names the login shell in $SHELL, in the profile or in config.fish
+// for fish.
+func shellEnv() string {
+	return "# " + strings.ToUpper(userShell) + "\n" + shellrc.Render(userShell, shellrc.Export("SHELL", userShell))
 }
 
 func confG4s() {
@@ -285,26 +269,7 @@ func confG4s() {
 }
 
 func confZshTheme() {
-	dlP10kPath := homeDir() + ".p10k.zsh"
-	resp, err := http.Get("https://raw.githubusercontent.com/leelsey/Dev4os/main/cmd/dev4os/dev4p10k")
-	if err != nil {
-		fmt.Println(lstDot + "Dev4os‘s p10k file URL is maybe changed, please check https://github.com/leelsey/Dev4os\n")
-		os.Exit(0)
-	}
-	defer func() {
-		err := resp.Body.Close()
-		checkError(err)
-	}()
-	rawFile, _ := ioutil.ReadAll(resp.Body)
-
-	p10kConf, err := os.OpenFile(dlP10kPath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, os.FileMode(0644))
-	checkError(err)
-	defer func() {
-		err := p10kConf.Close()
-		checkError(err)
-	}()
-	_, err = p10kConf.Write(rawFile)
-	checkError(err)
+	checkError(bootstrap.Run("theme", "-backend", "p10k"))
 }
 
 func updateDNF() {
@@ -390,34 +355,30 @@ func linuxEnv() {
 	ldBar.FinalMSG = " - Completed environment!\n"
 	ldBar.Start()
 
-	if checkShell() == "bash" {
-		profilePath := homeDir() + ".bash_profile"
-		shrcPath := homeDir() + ".bashrc"
-		confA4s()
+	if userShell == "bash" {
 		newBashProfile(profilePath)
 		newBashRC(shrcPath)
-
-		profileAppend := "# Alias4sh\n" +
-			"source ~/.config/alias4sh/aliasrc\n"
-		appendFile(profilePath, profileAppend)
-	} else if checkShell() == "zsh" {
+	} else if userShell == "zsh" {
 		dnfShell := exec.Command(superUser, cmdPMS, pmsIns, pmsYes, "zsh")
 
 		if err := dnfShell.Run(); err != nil {
 			checkError(err)
 		}
 
-		profilePath := homeDir() + ".zprofile"
-		shrcPath := homeDir() + ".zshrc"
-		confA4s()
 		newZProfile(profilePath)
 		newZshRC(shrcPath)
+	} else if userShell == "fish" {
+		dnfShell := exec.Command(superUser, cmdPMS, pmsIns, pmsYes, "fish")
 
-		profileAppend := "# Alias4sh\n" +
-			"source ~/.config/alias4sh/aliasrc\n"
-		appendFile(profilePath, profileAppend)
+		if err := dnfShell.Run(); err != nil {
+			checkError(err)
+		}
+
+		newFishConfig(shrcPath)
 	}
 	ldBar.Stop()
+
+	checkError(bootstrap.Run("aliases"))
 }
 
 func linuxGit() {
@@ -439,32 +400,32 @@ func linuxGit() {
 
 func linuxTerminal() {
 	ldBar := spinner.New(spinner.CharSets[16], 50*time.Millisecond)
-	ldBar.Suffix = " Installing zsh with useful tools..."
+	ldBar.Suffix = " Installing useful tools for terminal..."
 	ldBar.FinalMSG = " - Installed useful tools for terminal!\n"
 	ldBar.Start()
 
 	dnfTree := exec.Command(superUser, cmdPMS, pmsIns, pmsYes, "tree")
-	dnfZshSyntax := exec.Command(cmdGit, gitClone, "https://github.com/zsh-users/zsh-syntax-highlighting.git", "~/.zsh/zsh-syntax-highlighting")
-	dnfZshAuto := exec.Command(cmdGit, gitClone, "https://github.com/zsh-users/zsh-autosuggestions.git", "~/.zsh/zsh-autosuggestions")
-	dnfZshComp := exec.Command(cmdGit, gitClone, "https://github.com/zsh-users/zsh-completions.git", "~/.zsh/zsh-completions")
-	dnfZshTheme := exec.Command(cmdGit, gitClone, "https://github.com/romkatv/powerlevel10k.git", "~/.zsh/powerlevel10k")
 	if err := dnfTree.Run(); err != nil {
 		checkError(err)
 	}
-	if err := dnfZshSyntax.Run(); err != nil {
-		checkError(err)
-	}
-	if err := dnfZshAuto.Run(); err != nil {
-		checkError(err)
+	ldBar.Stop()
+
+	if userShell == "zsh" {
+		checkError(bootstrap.Run("zsh"))
 	}
-	if err := dnfZshComp.Run(); err != nil {
-		checkError(err)
+}
+
+// linuxLoginShell makes the shell the environment was written for the login
+// shell, the same way "dev4os shell use" does.
+func linuxLoginShell() {
+	if strings.HasSuffix(loginshell.Passwd(currentUser()), "/"+userShell) == true {
+		return
 	}
-	if err := dnfZshTheme.Run(); err != nil {
-		checkError(err)
+	if shellPath, err := loginshell.Change(userShell, currentUser(), superUser); err != nil {
+		fmt.Println(lstDot + "Failed to change login shell to " + userShell + " (" + err.Error() + "), run \"chsh -s $(command -v " + userShell + ")\" yourself.")
+	} else {
+		fmt.Println(lstDot + "Login shell is " + shellPath + ".")
 	}
-
-	ldBar.Stop()
 }
 
 func linuxDependency() {
@@ -761,24 +722,14 @@ func linuxDevToolCLI() {
 		checkError(err)
 	}
 
-	if checkShell() == "bash" {
-		shrcPath := homeDir() + "/.bashrc"
-		shrcAppend := "# DIRENV\n" +
-			"eval \"$(direnv hook bash)\"\n\n"
-		appendFile(shrcPath, shrcAppend)
-	} else if checkShell() == "zsh" {
-		shrcPath := homeDir() + "/.zshrc"
-		shrcAppend := "# DIRENV\n" +
-			"eval \"$(direnv hook zsh)\"\n\n"
-		appendFile(shrcPath, shrcAppend)
-	}
+	appendShell(shrcPath, "DIRENV", shellrc.Eval("direnv hook "+userShell))
 	ldBar.Stop()
 }
 
 func linuxASDF() {
 	ldBar := spinner.New(spinner.CharSets[16], 50*time.Millisecond)
-	ldBar.Suffix = " Installing ASDF-VM with plugin..."
-	ldBar.FinalMSG = " - Installed ASDF-VM, and add basic languages!\n"
+	ldBar.Suffix = " Installing ASDF-VM..."
+	ldBar.FinalMSG = " - Installed ASDF-VM!\n"
 	ldBar.Start()
 
 	dnfASDF := exec.Command(cmdGit, gitClone, "https://github.com/asdf-vm/asdf.git", homeDir()+".asdf", "--branch", "v0.10.2")
@@ -786,113 +737,22 @@ func linuxASDF() {
 		checkError(err)
 	}
 
-	shrcAppend := "# DIRENV\n" +
-		"source" + homeDir() + "/.asdf/asdf.sh\n" +
-		"source " + homeDir() + "/.asdf/completions/asdf.bash\n\n"
-	if checkShell() == "bash" {
-		shrcPath := homeDir() + "/.bashrc"
-		appendFile(shrcPath, shrcAppend)
-	} else if checkShell() == "zsh" {
-		shrcPath := homeDir() + "/.zshrc"
-		appendFile(shrcPath, shrcAppend)
-	}
-
-	pluginPath := homeDir() + ".asdf/plugins/"
-	if _, err := os.Stat(pluginPath + "perl"); errors.Is(err, os.ErrNotExist) {
-		addASDFPerl := exec.Command(cmdASDF, asdfPlugin, asdfAdd, "perl")
-		if err := addASDFPerl.Run(); err != nil {
-			checkError(err)
-		}
-	}
-	if _, err := os.Stat(pluginPath + "ruby"); errors.Is(err, os.ErrNotExist) {
-		addASDFRuby := exec.Command(cmdASDF, asdfPlugin, asdfAdd, "ruby")
-		if err := addASDFRuby.Run(); err != nil {
-			checkError(err)
-		}
-	}
-	if _, err := os.Stat(pluginPath + "python"); errors.Is(err, os.ErrNotExist) {
-		addASDFPython := exec.Command(cmdASDF, asdfPlugin, asdfAdd, "python")
-		if err := addASDFPython.Run(); err != nil {
-			checkError(err)
-		}
-	}
-	if _, err := os.Stat(pluginPath + "lua"); errors.Is(err, os.ErrNotExist) {
-		addASDFLua := exec.Command(cmdASDF, asdfPlugin, asdfAdd, "lua")
-		if err := addASDFLua.Run(); err != nil {
-			checkError(err)
-		}
-	}
-	if _, err := os.Stat(pluginPath + "golang"); errors.Is(err, os.ErrNotExist) {
-		addASDFGo := exec.Command(cmdASDF, asdfPlugin, asdfAdd, "golang")
-		if err := addASDFGo.Run(); err != nil {
-			checkError(err)
-		}
-	}
-	if _, err := os.Stat(pluginPath + "rust"); errors.Is(err, os.ErrNotExist) {
-		addASDFRust := exec.Command(cmdASDF, asdfPlugin, asdfAdd, "rust")
-		if err := addASDFRust.Run(); err != nil {
+	appendShell(shrcPath, "ASDF VM",
+		shellrc.Raw("source "+homeDir()+".asdf/asdf.sh", "source "+homeDir()+".asdf/asdf.fish"),
+		shellrc.Raw("source "+homeDir()+".asdf/completions/asdf.bash", ""))
+	if userShell == "fish" {
+		completionPath := homeDir() + ".config/fish/completions/"
+		if err := os.MkdirAll(completionPath, 0755); err != nil {
 			checkError(err)
 		}
-	}
-	if _, err := os.Stat(pluginPath + "nodejs"); errors.Is(err, os.ErrNotExist) {
-		addASDFNode := exec.Command(cmdASDF, asdfPlugin, asdfAdd, "nodejs")
-		if err := addASDFNode.Run(); err != nil {
-			checkError(err)
-		}
-	}
-	if _, err := os.Stat(pluginPath + "php"); errors.Is(err, os.ErrNotExist) {
-		addASDFPHP := exec.Command(cmdASDF, asdfPlugin, asdfAdd, "php")
-		if err := addASDFPHP.Run(); err != nil {
-			checkError(err)
-		}
-	}
-	if _, err := os.Stat(pluginPath + "java"); errors.Is(err, os.ErrNotExist) {
-		addASDFJava := exec.Command(cmdASDF, asdfPlugin, asdfAdd, "java")
-		if err := addASDFJava.Run(); err != nil {
-			checkError(err)
-		}
-	}
-	if _, err := os.Stat(pluginPath + "groovy"); errors.Is(err, os.ErrNotExist) {
-		addASDFGroovy := exec.Command(cmdASDF, asdfPlugin, asdfAdd, "groovy")
-		if err := addASDFGroovy.Run(); err != nil {
-			checkError(err)
-		}
-	}
-	if _, err := os.Stat(pluginPath + "kotlin"); errors.Is(err, os.ErrNotExist) {
-		addASDFKotlin := exec.Command(cmdASDF, asdfPlugin, asdfAdd, "kotlin")
-		if err := addASDFKotlin.Run(); err != nil {
-			checkError(err)
-		}
-	}
-	if _, err := os.Stat(pluginPath + "scala"); errors.Is(err, os.ErrNotExist) {
-		addASDFScala := exec.Command(cmdASDF, asdfPlugin, asdfAdd, "scala")
-		if err := addASDFScala.Run(); err != nil {
-			checkError(err)
-		}
-	}
-	if _, err := os.Stat(pluginPath + "clojure"); errors.Is(err, os.ErrNotExist) {
-		addASDFClojure := exec.Command(cmdASDF, asdfPlugin, asdfAdd, "clojure")
-		if err := addASDFClojure.Run(); err != nil {
-			checkError(err)
-		}
-	}
-	if _, err := os.Stat(pluginPath + "erlang"); errors.Is(err, os.ErrNotExist) {
-		addASDFErlang := exec.Command(cmdASDF, asdfPlugin, asdfAdd, "erlang")
-		if err := addASDFErlang.Run(); err != nil {
-			checkError(err)
-		}
-	}
-	if _, err := os.Stat(pluginPath + "elixir"); errors.Is(err, os.ErrNotExist) {
-		addASDFElixir := exec.Command(cmdASDF, asdfPlugin, asdfAdd, "elixir")
-		if err := addASDFElixir.Run(); err != nil {
-			checkError(err)
-		}
-	}
-	asdfReshim := exec.Command(cmdASDF, asdfShim)
-	if err := asdfReshim.Run(); err != nil {
+		rmFile(completionPath + "asdf.fish")
+		err := os.Symlink(homeDir()+".asdf/completions/asdf.fish", completionPath+"asdf.fish")
 		checkError(err)
 	}
+
 	ldBar.Stop()
+
+	checkError(bootstrap.Run("runtimes"))
 }
 
 func linuxServer() {
@@ -1036,23 +896,25 @@ func linuxUtility() {
 
 func linuxEnd() {
 	shrcAppend := "\n######## ADD CUSTOM VALUES UNDER HERE ########\n\n\n"
-	if checkShell() == "bash" {
-		shrcPath := homeDir() + "/.bashrc"
-		appendFile(shrcPath, shrcAppend)
-	} else if checkShell() == "zsh" {
-		shrcPath := homeDir() + "/.zshrc"
-		appendFile(shrcPath, shrcAppend)
-	}
+	appendFile(shrcPath, shrcAppend)
 }
 
 func main() {
 	fmt.Println("\nDev4mac v" + appVer + "\n")
+	if _, err := bootstrap.Path(); err != nil {
+		fmt.Println(lstDot + err.Error() + "\n")
+		os.Exit(1)
+	}
+	// The dev4os steps write their blocks for the shell this run sets up.
+	os.Setenv("DEV4OS_SHELL", userShell)
 	if checkNetStatus() == true {
+		checkError(bootstrap.StartBackup("dev4rpm"))
 		linuxBegin()
 		linuxBasic()
 		linuxEnv()
 		linuxGit()
 		linuxTerminal()
+		linuxLoginShell()
 		linuxDependency()
 		linuxDevToolCLI()
 		linuxASDF()
@@ -1086,7 +948,7 @@ func main() {
 		}
 		fmt.Println("\n----------Finished!----------\n" +
 			"Please RESTART your terminal!\n" +
-			lstDot + "Enter this on terminal: source ~/.zprofile && source ~/.zshrc\n" +
+			lstDot + "Enter this on terminal: " + sourceHint() + "\n" +
 			lstDot + "Or restart the Terminal.app by yourself.\n")
 	} else {
 		fmt.Println(lstDot + "Please check your internet connection and try again.\n")
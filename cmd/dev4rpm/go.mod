@@ -3,6 +3,7 @@ module dev4rpm
 go 1.18
 
 require (
+	dev4os v0.0.0
 	github.com/briandowns/spinner v1.18.1
 )
 
@@ -17,3 +18,7 @@ require (
 	golang.org/x/sys v0.0.0-20220128215802-99c3d69c2c27 // indirect
 	golang.org/x/term v0.0.0-20210927222741-03fcf44c2211 // indirect
 )
+
+// dev4os/loginshell, dev4os/shellrc and dev4os/bootstrap are shared with the
+// dev4os command.
+replace dev4os => ../dev4os
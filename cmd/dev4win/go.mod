@@ -5,6 +5,7 @@ go 1.18
 require (
 	github.com/briandowns/spinner v1.18.1
 	github.com/schollz/progressbar/v3 v3.8.7
+	golang.org/x/sys v0.0.0-20220128215802-99c3d69c2c27
 )
 
 require (
@@ -15,6 +16,5 @@ require (
 	github.com/mitchellh/colorstring v0.0.0-20190213212951-d06e56a500db // indirect
 	github.com/rivo/uniseg v0.2.0 // indirect
 	golang.org/x/crypto v0.0.0-20220131195533-30dcbda58838 // indirect
-	golang.org/x/sys v0.0.0-20220128215802-99c3d69c2c27 // indirect
 	golang.org/x/term v0.0.0-20210927222741-03fcf44c2211 // indirect
 )